@@ -1,7 +1,8 @@
 package gopar
 
 import (
-	"strings"
+	"regexp"
+	"unicode"
 )
 
 func S(str string) Parser {
@@ -22,19 +23,36 @@ func OneOf(parsers ...Parser) Parser {
 	return &oneOfRule{parsers, "_OneOf"}
 }
 
+// OneOfChars matches any one of the characters in chars.
 func OneOfChars(chars string) Parser {
 	if len(chars) == 0 {
 		panic("empty oneOfRule not allowed")
 	}
-	charParsers := make([]Parser,len(chars))
-	for i,c := range chars {
-		charParsers[i] = &stringRule{
-			string(c),
-			"",
-		}
-	}
-	ruleName := "{" + strings.Join(strings.Split(chars,""),"|") + "}"
-	return &oneOfRule{charParsers, ruleName}
+	ranges := rangesOf(chars)
+	return newCharClass(ranges, nil, false, describeRanges(ranges, false), "_OneOfChars")
+}
+
+// NoneOf matches any one character that isn't in chars.
+func NoneOf(chars string) Parser {
+	ranges := rangesOf(chars)
+	return newCharClass(ranges, nil, true, describeRanges(ranges, true), "_NoneOf")
+}
+
+// CharRange matches any one character from lo to hi.
+func CharRange(lo, hi rune) Parser {
+	ranges := []runeRange{{lo, hi}}
+	return newCharClass(ranges, nil, false, describeRanges(ranges, false), "_CharRange")
+}
+
+// AnyChar matches any one character.
+func AnyChar() Parser {
+	return newCharClass([]runeRange{{0, unicode.MaxRune}}, nil, false, "any character", "_AnyChar")
+}
+
+// UnicodeClass matches any one character from the given tables, e.g.
+// unicode.Letter or unicode.Digit.
+func UnicodeClass(tables ...*unicode.RangeTable) Parser {
+	return newCharClass(nil, tables, false, describeTables(tables), "_UnicodeClass")
 }
 
 func AtLeastNumOf(parser Parser, num int) Parser {
@@ -64,4 +82,109 @@ func P(parserName string) Parser {
 	return &placeholderRule{patchRuleName:parserName}
 }
 
+// Collect pushes the text matched by parser onto the Stack.
+func Collect(parser Parser) Parser {
+	return &collectorRule{parser, "_Collect"}
+}
+
+// Assemble runs assemble after parser matches so that it can pop the values
+// parser left on the Stack and push whatever node they make up. An error from
+// assemble fails the rule; return a ParseError if the parse should be allowed
+// to backtrack and try something else.
+func Assemble(parser Parser, assemble func(*Stack) error) Parser {
+	return &assembleRule{
+		parser,
+		func(stack *Stack, mark int) error { return assemble(stack) },
+		"_Assemble",
+	}
+}
+
+// DelimitedSeq matches zero or more elem separated by sep, e.g. the values
+// of a list. Like every other repetition it is greedy: a separator is only
+// consumed if an element follows it.
+func DelimitedSeq(elem, sep Parser) Parser {
+	return DelimitedSeqOf(elem, sep, 0, MaxInt, NoTrailing)
+}
+
+// DelimitedSeqOf matches between min and max elem separated by sep.
+// trailing controls whether a separator after the last element is left
+// alone, consumed if it's there, or required.
+func DelimitedSeqOf(elem, sep Parser, min, max int, trailing Trailing) Parser {
+	return &delimitedSeqRule{elem, sep, min, max, trailing, "_DelimitedSeq"}
+}
+
+// Skip parses parser with skipper consumed in front of every token (S, SFold,
+// Keywords, R, character classes and Token rules) and after the last one.
+// skipper is typically optional whitespace and comments.
+func Skip(skipper, parser Parser) Parser {
+	return &skipRule{skipper, parser, "_Skip"}
+}
+
+// Token consumes the skipper in front of parser but not inside it, which is
+// what lexical rules such as a quoted string want.
+func Token(parser Parser) Parser {
+	return &tokenRule{parser, "_Token"}
+}
+
+// Expression parses operands joined by operators, taking precedence and
+// associativity into account, and pushes the result as nested ExprNodes.
+// operand is tried wherever an operand can go; if it doesn't push a value
+// the text it matched is used.
+func Expression(operand Parser, operators ...Operator) Parser {
+	return &expressionRule{operand, operators, "_Expression"}
+}
+
+// Prefix is an operator in front of its operand, like the '-' in -x.
+func Prefix(op Parser, power int) Operator {
+	return Operator{op, power, RightAssoc, prefix}
+}
+
+// Infix is an operator between two operands, like the '+' in a+b.
+func Infix(op Parser, power int, assoc Assoc) Operator {
+	return Operator{op, power, assoc, infix}
+}
 
+// Postfix is an operator after its operand, like the '!' in n!.
+func Postfix(op Parser, power int) Operator {
+	return Operator{op, power, LeftAssoc, postfix}
+}
+
+// Not matches, without consuming anything, where parser doesn't match, e.g.
+// Seq(Not(keyword), ident) for an identifier that isn't a keyword.
+func Not(parser Parser) Parser {
+	return &notRule{parser, "_Not"}
+}
+
+// And matches, without consuming anything, where parser matches.
+func And(parser Parser) Parser {
+	return &andRule{parser, "_And"}
+}
+
+// EOF matches the end of the input. Inside Skip, the skipper may come first.
+func EOF() Parser {
+	return Not(&anyRule{"_Any"}).Rename("EOF")
+}
+
+// R matches the regular expression pattern (see package regexp) at the
+// current position, e.g. R(`[0-9]+(\.[0-9]+)?`) for a number. Like S it is a
+// token. R panics if pattern doesn't compile.
+func R(pattern string) Parser {
+	return &regexpRule{regexp.MustCompile(`^(?:` + pattern + `)`), pattern, "_Regexp"}
+}
+
+// SFold is S but ignores case, using Unicode simple case folding.
+func SFold(str string) Parser {
+	return &foldRule{str, "_StringFold"}
+}
+
+// Keywords matches the longest of words that ends at a word boundary, so
+// Keywords("select") doesn't match "selection". Words ending in punctuation,
+// like "<=", may be followed by anything.
+func Keywords(words ...string) Parser {
+	return newKeywords(words, false, "_Keywords")
+}
+
+// KeywordsFold is Keywords but ignores case.
+func KeywordsFold(words ...string) Parser {
+	return newKeywords(words, true, "_KeywordsFold")
+}
@@ -91,7 +91,7 @@ func TestRenaming(t *testing.T) {
 	prod := Seq(num, S("*"), num).Rename("Product")
 	sum := Seq(prod, S("+"), prod).Rename("Sum")
 	expectNoErr(t, sum, "33*44+1*3")
-	expectErr(t, sum, "3*4+*35", "error at offset 4 in rule Sum>Product>Number>>{0|1|2|3|4|5|6|7|8|9}>'0'. expected '0' found '*'")
+	expectErr(t, sum, "3*4+*35", "error at offset 4 in rule Sum>Product>Number>>[0-9]. expected [0-9] found '*'")
 }
 
 func TestPlaceholders(t *testing.T) {
@@ -118,5 +118,103 @@ func TestPlaceholders(t *testing.T) {
 
 	expectNoErr(t, sentence, "asd qwer sdfg erty!")
 	expectNoErr(t, sentence, "asd qwer 'sdfg erty werq!' he said!")
-	expectErr(t, sentence, "asd qwer 'sdfg erty werq he said!", "error at offset 8 in rule Sentence>{!|?}>'!'. expected '!' found ' '")
+	expectErr(t, sentence, "asd qwer 'sdfg erty werq he said!", "error at offset 8 in rule Sentence>[!?]. expected [!?] found ' '")
+}
+
+func TestCollectAndAssemble(t *testing.T) {
+	num := Collect(OneOrMoreOf(OneOfChars("0123456789"))).Rename("Number")
+	sum := Assemble(Seq(num, S("+"), num), func(stack *Stack) error {
+		right := stack.Pop().(string)
+		left := stack.Pop().(string)
+		stack.Push([]string{left, right})
+		return nil
+	}).Rename("Sum")
+	expectNoErr(t, sum, "12+345")
+	expectValues(t, sum, "12+345", []string{"12", "345"})
+	expectErr(t, sum, "12-345", "error at offset 2 in rule Sum>_Sequence>'+'. expected '+' found '-'")
+}
+
+func TestDelimitedSeq(t *testing.T) {
+	value := OneOfChars("123").Rename("Value")
+	rule := Seq(S("["), DelimitedSeq(value, S(",")), S("]"))
+	expectNoErr(t, rule, "[]")
+	expectNoErr(t, rule, "[1,2,3]")
+	expectErr(t, rule, "[1,,2]", "error at offset 2 in rule _Sequence>']'. expected ']' found ','")
+}
+
+func TestDelimitedSeqOf(t *testing.T) {
+	value := OneOfChars("123").Rename("Value")
+
+	counted := Seq(DelimitedSeqOf(value, S(","), 2, 3, NoTrailing), S(";"))
+	expectNoErr(t, counted, "1,2;")
+	expectNoErr(t, counted, "1,2,3;")
+	expectErr(t, counted, "1;", "error at offset 1 in rule _Sequence>_DelimitedSeq>','. expected ',' found ';'")
+	expectErr(t, counted, "1,;", "error at offset 2 in rule _Sequence>_DelimitedSeq>Value. expected [1-3] found ';'")
+	expectErr(t, counted, "1,2,3,1;", "error at offset 5 in rule _Sequence>';'. expected ';' found ','")
+
+	optional := Seq(DelimitedSeqOf(value, S(","), 0, MaxInt, OptionalTrailing), S(";"))
+	expectNoErr(t, optional, ";")
+	expectNoErr(t, optional, "1,2;")
+	expectNoErr(t, optional, "1,2,;")
+	expectErr(t, optional, ",;", "error at offset 0 in rule _Sequence>';'. expected ';' found ','")
+
+	required := Seq(DelimitedSeqOf(value, S(","), 0, 2, RequiredTrailing), S(";"))
+	expectNoErr(t, required, ";")
+	expectNoErr(t, required, "1,;")
+	expectNoErr(t, required, "1,2,;")
+	expectErr(t, required, "1,2;", "error at offset 3 in rule _Sequence>_DelimitedSeq>','. expected ',' found ';'")
+}
+
+func TestSkip(t *testing.T) {
+	letter := OneOfChars("abcdefghijklmnopqrstuvwxyz").Rename("Letter")
+	comment := OneOf(
+		Seq(S("//"), ZeroOrMoreOf(OneOfChars("abcdefghijklmnopqrstuvwxyz \t")), S("\n")),
+		Seq(S("/*"), ZeroOrMoreOf(OneOfChars("abcdefghijklmnopqrstuvwxyz \t\n")), S("*/")),
+	)
+	skipper := ZeroOrMoreOf(OneOf(OneOfChars(" \t\n"), comment))
+
+	str := Token(Seq(S("\""), ZeroOrMoreOf(letter), S("\""))).Rename("String")
+	list := Skip(skipper, Seq(S("["), DelimitedSeq(str, S(",")), S("]"))).Rename("List")
+
+	expectNoErr(t, list, `["ab","c"]`)
+	expectNoErr(t, list, ` [ "ab" ,"c"  ] `)
+	expectNoErr(t, list, "[ // the list\n \"ab\", /* comment\n */ \"c\"]\n")
+	// errors point past the skipped input
+	expectErr(t, list, `[ "a"  x]`, "error at offset 7 in rule List>_Sequence>']'. expected ']' found 'x'")
+	expectErr(t, list, "[ \"a\" /* */ ", "error at offset 12 in rule List>_Sequence>']'. EOF")
+	// no skipping inside of a token
+	expectErr(t, list, `[ " a"]`, "error at offset 2 in rule List>_Sequence>']'. expected ']' found '\"'")
+}
+
+func TestSkipBeforeCollect(t *testing.T) {
+	// what the skipper matched isn't collected
+	rule := Skip(ZeroOrMoreOf(S(" ")), Seq(Collect(S("a")), Collect(S("b"))))
+	expectValues(t, rule, "a  b", "a", "b")
+}
+
+func TestNotAndAnd(t *testing.T) {
+	letters := OneOrMoreOf(OneOfChars("abcdefghijklmnopqrstuvwxyz"))
+	keyword := Seq(OneOf(S("if"), S("else")), Not(OneOfChars("abcdefghijklmnopqrstuvwxyz")))
+	ident := Seq(Not(keyword), letters).Rename("Ident")
+	expectNoErr(t, ident, "x")
+	expectNoErr(t, ident, "iffy")
+	expectNoErr(t, ident, "elsewhere")
+	expectErr(t, ident, "if", "error at offset 0 in rule Ident>_Not. unexpected 'i'")
+	expectErr(t, ident, "else", "error at offset 0 in rule Ident>_Not. unexpected 'e'")
+
+	// And doesn't consume what it looks at
+	call := Seq(And(Seq(letters, S("("))), letters, S("()"))
+	expectNoErr(t, call, "f()")
+	expectErr(t, call, "f", "error at offset 1 in rule _Sequence>_And>_Sequence>'('. EOF")
+}
+
+func TestEOF(t *testing.T) {
+	rule := Seq(S("a"), EOF())
+	expectNoErr(t, rule, "a")
+	expectErr(t, rule, "ab", "error at offset 1 in rule _Sequence>EOF. unexpected 'b'")
+	expectErr(t, rule, "aü", "error at offset 1 in rule _Sequence>EOF. unexpected 'ü'")
+	expectErr(t, rule, "a\xff", "error at offset 1 in rule _Sequence>EOF. unexpected invalid UTF-8 byte 0xff")
+	// AnyChar takes the whole rune, not just its first byte
+	expectNoErr(t, Seq(AnyChar(), EOF()), "ü")
+	expectNoErr(t, Skip(ZeroOrMoreOf(S(" ")), rule), "a  ")
 }
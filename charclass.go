@@ -0,0 +1,187 @@
+package gopar
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type runeRange struct {
+	lo, hi rune
+}
+
+// charClassRule matches a single UTF-8 encoded rune. ASCII is looked up in a
+// bitmap, everything else in sorted ranges and Unicode tables.
+type charClassRule struct {
+	ascii  [2]uint64
+	ranges []runeRange
+	tables []*unicode.RangeTable
+	negate bool
+	// how error messages refer to the class, e.g. [a-z]
+	desc string
+	name string
+}
+
+func newCharClass(ranges []runeRange, tables []*unicode.RangeTable, negate bool, desc, name string) *charClassRule {
+	// in looks ranges up by binary search, they mustn't overlap
+	ranges = mergeRanges(ranges)
+	rule := &charClassRule{ranges: ranges, tables: tables, negate: negate, desc: desc, name: name}
+	for r := rune(0); r < utf8.RuneSelf; r++ {
+		if rule.in(r) != negate {
+			rule.ascii[r/64] |= 1 << uint(r%64)
+		}
+	}
+	return rule
+}
+
+// in reports whether r is in the class before negation
+func (rule charClassRule) in(r rune) bool {
+	i := sort.Search(len(rule.ranges), func(i int) bool { return rule.ranges[i].hi >= r })
+	if i < len(rule.ranges) && rule.ranges[i].lo <= r {
+		return true
+	}
+	return unicode.In(r, rule.tables...)
+}
+
+func (rule charClassRule) matches(r rune) bool {
+	if r < utf8.RuneSelf {
+		// the bitmap already has the negation
+		return rule.ascii[r/64]&(1<<uint(r%64)) != 0
+	}
+	return rule.in(r) != rule.negate
+}
+
+func (rule charClassRule) Parse(input *ThreadSafeBufferedReader) error {
+	if err := skip(input); err != nil {
+		return err
+	}
+	start := input.Offset()
+	frame := Frame{rule.name, KindCharClass, start}
+	if isInternalName(rule.name) {
+		frame.Name = rule.desc
+	}
+	r, raw, err := input.readRune()
+	if err == io.EOF {
+		return ParseError{
+			Offset:   start,
+			Path:     []Frame{frame},
+			Msg:      "EOF",
+			Expected: []string{rule.desc},
+			Found:    "EOF",
+		}
+	} else if err != nil {
+		return err
+	}
+	if !rule.matches(r) {
+		found := quoteRune(r, raw)
+		return ParseError{
+			Offset:   start,
+			Path:     []Frame{frame},
+			Msg:      fmt.Sprintf("expected %s found %s", rule.desc, found),
+			Expected: []string{rule.desc},
+			Found:    found,
+		}
+	}
+	return nil
+}
+func (rule charClassRule) GetSubRules() []Parser {
+	return []Parser{}
+}
+func (rule charClassRule) GetName() string {
+	return rule.name
+}
+func (rule *charClassRule) Rename(name string) Parser {
+	rule.name = name
+	return rule
+}
+
+// rangesOf turns chars into as few ranges as possible
+func rangesOf(chars string) []runeRange {
+	var ranges []runeRange
+	for _, r := range chars {
+		ranges = append(ranges, runeRange{r, r})
+	}
+	return mergeRanges(ranges)
+}
+
+// mergeRanges sorts ranges and joins the ones that overlap or touch
+func mergeRanges(ranges []runeRange) []runeRange {
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].lo < ranges[j].lo })
+	var merged []runeRange
+	for _, rr := range ranges {
+		if n := len(merged); n > 0 && rr.lo <= merged[n-1].hi+1 {
+			if rr.hi > merged[n-1].hi {
+				merged[n-1].hi = rr.hi
+			}
+		} else {
+			merged = append(merged, rr)
+		}
+	}
+	return merged
+}
+
+// describeRanges renders ranges the way a regular expression would, e.g.
+// [0-9a-f]
+func describeRanges(ranges []runeRange, negate bool) string {
+	var desc strings.Builder
+	desc.WriteString("[")
+	if negate {
+		desc.WriteString("^")
+	}
+	for _, rr := range ranges {
+		desc.WriteString(describeRune(rr.lo))
+		switch {
+		case rr.hi == rr.lo+1:
+			desc.WriteString(describeRune(rr.hi))
+		case rr.hi > rr.lo:
+			desc.WriteString("-" + describeRune(rr.hi))
+		}
+	}
+	desc.WriteString("]")
+	return desc.String()
+}
+
+func describeRune(r rune) string {
+	switch r {
+	case '\\', ']', '[', '^', '-':
+		return `\` + string(r)
+	}
+	if unicode.IsPrint(r) {
+		return string(r)
+	}
+	quoted := fmt.Sprintf("%+q", r)
+	return quoted[1 : len(quoted)-1]
+}
+
+// describeTables names tables after the Unicode category, script or property
+// they are, e.g. \p{L} for unicode.Letter
+func describeTables(tables []*unicode.RangeTable) string {
+	var names []string
+	for _, table := range tables {
+		names = append(names, `\p{`+tableName(table)+`}`)
+	}
+	if len(names) == 1 {
+		return names[0]
+	}
+	return "[" + strings.Join(names, "") + "]"
+}
+
+func tableName(table *unicode.RangeTable) string {
+	for _, tables := range []map[string]*unicode.RangeTable{unicode.Categories, unicode.Scripts, unicode.Properties} {
+		// several names can share a table, so pick the same one every time
+		var found []string
+		for name, t := range tables {
+			if t == table {
+				found = append(found, name)
+			}
+		}
+		if len(found) > 0 {
+			sort.Strings(found)
+			return found[0]
+		}
+	}
+	return "?"
+}
@@ -0,0 +1,92 @@
+package gopar
+
+import (
+	"strings"
+	"testing"
+	"unicode"
+)
+
+func TestCharRange(t *testing.T) {
+	rule := OneOrMoreOf(CharRange('a', 'f'))
+	expectNoErr(t, rule, "cafe")
+	expectErr(t, CharRange('a', 'f'), "g", "error at offset 0 in rule [a-f]. expected [a-f] found 'g'")
+	expectErr(t, CharRange('a', 'f'), "", "error at offset 0 in rule [a-f]. EOF")
+	expectNoErr(t, CharRange('α', 'ω'), "λ")
+}
+
+func TestOneOfCharsWithMultiByteCharacters(t *testing.T) {
+	rule := OneOrMoreOf(OneOfChars("aあい"))
+	expectNoErr(t, rule, "aいあa")
+	expectErr(t, OneOfChars("aあい"), "う", "error at offset 0 in rule [aあい]. expected [aあい] found 'う'")
+	expectErr(t, Seq(S("a"), OneOfChars("あい")), "aう", "error at offset 1 in rule _Sequence>[あい]. expected [あい] found 'う'")
+}
+
+func TestNoneOf(t *testing.T) {
+	str := Seq(S(`"`), ZeroOrMoreOf(OneOf(NoneOf(`"\`), Seq(S(`\`), AnyChar()))), S(`"`))
+	expectNoErr(t, str, `""`)
+	expectNoErr(t, str, `"a \"quoted\" ü"`)
+	expectErr(t, NoneOf(`"\`), `\`, `error at offset 0 in rule [^"\\]. expected [^"\\] found '\'`)
+	expectErr(t, NoneOf("\n\t"), "\t", `error at offset 0 in rule [^\t\n]. expected [^\t\n] found '	'`)
+	expectNoErr(t, NoneOf("a"), "あ")
+}
+
+func TestAnyChar(t *testing.T) {
+	expectNoErr(t, Seq(AnyChar(), AnyChar()), "aあ")
+	expectErr(t, AnyChar(), "", "error at offset 0 in rule any character. EOF")
+}
+
+func TestUnicodeClass(t *testing.T) {
+	ident := Seq(UnicodeClass(unicode.Letter), ZeroOrMoreOf(UnicodeClass(unicode.Letter, unicode.Digit)))
+	expectNoErr(t, ident, "x1")
+	expectNoErr(t, ident, "größe2")
+	expectNoErr(t, ident, "変数")
+	expectErr(t, ident, "1x", `error at offset 0 in rule _Sequence>\p{L}. expected \p{L} found '1'`)
+	expectErr(t, Seq(UnicodeClass(unicode.Letter, unicode.Digit), S(";")), "!", `error at offset 0 in rule _Sequence>[\p{L}\p{Nd}]. expected [\p{L}\p{Nd}] found '!'`)
+	expectFurthestErr(t, ident.Rename("Ident"), "-", "error at offset 0 (line 1, column 1) in rule Ident. expected Ident found '-'")
+}
+
+func TestDescribeRanges(t *testing.T) {
+	for chars, expected := range map[string]string{
+		"0123456789":    "[0-9]",
+		"ab":            "[ab]",
+		"fedcba-":       `[\-a-f]`,
+		"]^[":           `[\[\]\^]`,
+		" \t\n":         `[\t\n ]`,
+		"abcxyz0123456": "[0-6a-cx-z]",
+	} {
+		if desc := describeRanges(rangesOf(chars), false); desc != expected {
+			t.Errorf("%q: unexpected description %s", chars, desc)
+		}
+	}
+}
+
+func TestOverlappingRanges(t *testing.T) {
+	class := newCharClass([]runeRange{{'d', 'e'}, {'a', 'z'}, {'b', 'c'}, {'α', 'ω'}, {'β', 'γ'}}, nil, false, "[a-zα-ω]", "_")
+	for _, r := range "aceyzαδω" {
+		if !class.matches(r) {
+			t.Errorf("%c should match", r)
+		}
+	}
+	if len(class.ranges) != 2 {
+		t.Errorf("unexpected ranges %v", class.ranges)
+	}
+}
+
+func TestReadRune(t *testing.T) {
+	input := NewReader(strings.NewReader("aあ\xffb\xe3\x81"))
+	for _, expected := range []struct {
+		r    rune
+		size int
+	}{{'a', 1}, {'あ', 3}, {unicode.ReplacementChar, 1}, {'b', 1}, {unicode.ReplacementChar, 1}, {unicode.ReplacementChar, 1}} {
+		r, size, err := input.ReadRune()
+		if err != nil || r != expected.r || size != expected.size {
+			t.Errorf("unexpected rune: %q %d %v", r, size, err)
+		}
+	}
+	if _, _, err := input.ReadRune(); err == nil {
+		t.Error("expected EOF")
+	}
+	if input.Offset() != 8 {
+		t.Errorf("unexpected offset: %d", input.Offset())
+	}
+}
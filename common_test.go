@@ -1,22 +1,14 @@
 package gopar
 
 import (
-	"bytes"
 	"strings"
 	"testing"
 )
 
 func expectNoErr(t *testing.T, rule Parser, inText string) {
-	expected := []byte("XYZ123")
-	input := NewReader(strings.NewReader(inText + "XYZ123"))
-	err := rule.Parse(input)
-	found := make([]byte, 6)
-	if err != nil {
+	if err := ParseAll(rule, strings.NewReader(inText)); err != nil {
 		t.Error("unexpected error:", err)
 	}
-	if input.Read(found); bytes.Compare(found, expected) != 0 {
-		t.Error("input reader set to wrong index")
-	}
 }
 
 func expectErr(t *testing.T, rule Parser, inText, errText string) {
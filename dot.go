@@ -0,0 +1,251 @@
+package gopar
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+/*
+WriteDot draws the rules themselves rather than what they accept: one node
+per rule value, so a rule used in two places is drawn once with two edges
+into it. Placeholders point at the rule Patch put in for them with a dashed
+edge that doesn't take part in the layout, which keeps recursive grammars
+readable and shows at a glance which placeholders were never patched. Turn
+the file into a picture with Graphviz:
+
+	dot -Tsvg grammar.dot > grammar.svg
+*/
+
+// DotOptions control the graph WriteDotWithOptions writes.
+type DotOptions struct {
+	// draw every named rule in a box of its own, along with the unnamed
+	// rules it's made of
+	Cluster bool
+}
+
+type dotEdge struct {
+	from, to int
+	label    string
+	// from a placeholder to the rule it was patched with
+	patched bool
+}
+
+type dotWriter struct {
+	ids   map[ruleID]int
+	rules []Parser
+	// the named rule each rule belongs to, -1 for none
+	owners []int
+	edges  []dotEdge
+}
+
+// WriteDot writes the graph of rules, and every rule they're made of, to w
+// in Graphviz DOT.
+func WriteDot(w io.Writer, rules ...Parser) error {
+	return WriteDotWithOptions(w, DotOptions{}, rules...)
+}
+
+// WriteDotWithOptions is WriteDot with options.
+func WriteDotWithOptions(w io.Writer, options DotOptions, rules ...Parser) error {
+	d := &dotWriter{ids: map[ruleID]int{}}
+	for _, rule := range rules {
+		d.visit(rule, -1)
+	}
+
+	var out strings.Builder
+	out.WriteString("digraph grammar {\n\tordering=out;\n\tnode [fontname=\"monospace\", fontsize=11];\n\tedge [fontsize=9];\n")
+	if options.Cluster {
+		members := map[int][]int{}
+		for id, owner := range d.owners {
+			members[owner] = append(members[owner], id)
+		}
+		for id := range d.rules {
+			if d.owners[id] != id {
+				continue
+			}
+			fmt.Fprintf(&out, "\tsubgraph cluster_%d {\n\t\tlabel=%s;\n\t\tstyle=rounded;\n", id, dotQuote(d.rules[id].GetName()))
+			for _, member := range members[id] {
+				out.WriteString("\t" + d.node(member))
+			}
+			out.WriteString("\t}\n")
+		}
+		for _, member := range members[-1] {
+			out.WriteString(d.node(member))
+		}
+	} else {
+		for id := range d.rules {
+			out.WriteString(d.node(id))
+		}
+	}
+	for _, edge := range d.edges {
+		var attrs []string
+		if edge.label != "" {
+			attrs = append(attrs, "label="+dotQuote(edge.label))
+		}
+		if edge.patched {
+			attrs = append(attrs, "style=dashed", "constraint=false", "color=\"#4060c0\"")
+		}
+		fmt.Fprintf(&out, "\tn%d -> n%d", edge.from, edge.to)
+		if len(attrs) > 0 {
+			fmt.Fprintf(&out, " [%s]", strings.Join(attrs, ", "))
+		}
+		out.WriteString(";\n")
+	}
+	out.WriteString("}\n")
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+// visit numbers rule and everything it's made of, returning rule's number.
+// owner is the named rule the one that led here belongs to.
+func (d *dotWriter) visit(rule Parser, owner int) int {
+	rule = unwrapRule(rule)
+	if id, ok := d.ids[idOf(rule)]; ok {
+		return id
+	}
+	id := len(d.rules)
+	d.ids[idOf(rule)] = id
+	d.rules = append(d.rules, rule)
+	placeholder, isPlaceholder := rule.(*placeholderRule)
+	if !isPlaceholder && !isInternalName(rule.GetName()) && !isOneOrMoreOf(rule) {
+		owner = id
+	}
+	d.owners = append(d.owners, owner)
+
+	if isPlaceholder {
+		if placeholder.patchRule != nil {
+			d.edges = append(d.edges, dotEdge{id, d.visit(placeholder.patchRule, owner), "", true})
+		}
+		return id
+	}
+	for _, sub := range dotSubRules(rule) {
+		d.edges = append(d.edges, dotEdge{id, d.visit(sub.rule, owner), sub.label, false})
+	}
+	return id
+}
+
+type dotSubRule struct {
+	label string
+	rule  Parser
+}
+
+// dotSubRules labels the sub rules that don't all play the same part
+func dotSubRules(rule Parser) []dotSubRule {
+	switch rule := rule.(type) {
+	case *delimitedSeqRule:
+		return []dotSubRule{{"", rule.elem}, {"sep", rule.sep}}
+	case *skipRule:
+		return []dotSubRule{{"skipper", rule.skipper}, {"", rule.subRule}}
+	case *expressionRule:
+		subs := []dotSubRule{{"operand", rule.operand}}
+		for _, op := range rule.operators {
+			label := fmt.Sprintf("infix %d", op.power)
+			switch op.fixity {
+			case prefix:
+				label = fmt.Sprintf("prefix %d", op.power)
+			case postfix:
+				label = fmt.Sprintf("postfix %d", op.power)
+			}
+			subs = append(subs, dotSubRule{label, op.op})
+		}
+		return subs
+	}
+	var subs []dotSubRule
+	for _, sub := range rule.GetSubRules() {
+		subs = append(subs, dotSubRule{"", sub})
+	}
+	return subs
+}
+
+// node writes the statement for rule id: its kind, and its name if it has
+// one, in a shape that goes with the kind
+func (d *dotWriter) node(id int) string {
+	rule := d.rules[id]
+	kind, shape, style := dotKind(rule)
+	label := kind
+	attrs := ""
+	if placeholder, ok := rule.(*placeholderRule); ok {
+		label = fmt.Sprintf("P(%s)", placeholder.patchRuleName)
+		style = "dashed"
+		if placeholder.patchRule == nil {
+			label += "\nnot patched"
+			attrs = ", color=red, fontcolor=red"
+		}
+	} else if name := rule.GetName(); !isInternalName(name) && name != kind {
+		label = name + "\n" + kind
+		style = strings.TrimPrefix(style+",bold", ",")
+	}
+	if style != "" {
+		attrs = fmt.Sprintf(", style=%q", style) + attrs
+	}
+	return fmt.Sprintf("\tn%d [label=%s, shape=%s%s];\n", id, dotQuote(label), shape, attrs)
+}
+
+// dotKind says what sort of rule rule is and the shape and style it's drawn
+// in
+func dotKind(rule Parser) (string, string, string) {
+	switch rule := rule.(type) {
+	case *stringRule:
+		return fmt.Sprintf("%q", rule.str), "box", "rounded"
+	case *foldRule:
+		return fmt.Sprintf("%q (any case)", rule.str), "box", "rounded"
+	case *charClassRule:
+		return rule.desc, "box", "rounded"
+	case *keywordsRule:
+		return rule.desc, "box", "rounded"
+	case *regexpRule:
+		return fmt.Sprintf("/%s/", rule.pattern), "box", "rounded"
+	case *anyRule:
+		return "any character", "box", "rounded"
+	case *sequenceRule:
+		if _, ok := repeatedByOneOrMoreOf(rule); ok {
+			return "OneOrMoreOf", "box", ""
+		}
+		return "Seq", "box", ""
+	case *oneOfRule:
+		return "OneOf", "diamond", ""
+	case *atLeastNumOfRule:
+		return fmt.Sprintf("%s..*", dotCount(rule.num)), "ellipse", ""
+	case *asManyAsNumOfRule:
+		return fmt.Sprintf("0..%s", dotCount(rule.num)), "ellipse", ""
+	case *delimitedSeqRule:
+		kind := fmt.Sprintf("DelimitedSeq %s..%s", dotCount(rule.min), dotCount(rule.max))
+		switch rule.trailing {
+		case OptionalTrailing:
+			kind += "\noptional trailing"
+		case RequiredTrailing:
+			kind += "\nrequired trailing"
+		}
+		return kind, "ellipse", ""
+	case *placeholderRule:
+		return "P", "cds", ""
+	case *collectorRule:
+		return "Collect", "note", ""
+	case *assembleRule:
+		return "Assemble", "note", ""
+	case *tokenRule:
+		return "Token", "note", ""
+	case *skipRule:
+		return "Skip", "note", ""
+	case *notRule:
+		return "Not", "invhouse", ""
+	case *andRule:
+		return "And", "invhouse", ""
+	case *expressionRule:
+		return "Expression", "hexagon", ""
+	}
+	return fmt.Sprintf("%T", rule), "box", ""
+}
+
+func dotCount(n int) string {
+	if n == MaxInt {
+		return "*"
+	}
+	return fmt.Sprint(n)
+}
+
+// dotQuote quotes s as a DOT string, with line breaks centered
+func dotQuote(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+	return `"` + s + `"`
+}
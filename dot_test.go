@@ -0,0 +1,94 @@
+package gopar
+
+import (
+	"bytes"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestWriteDot(t *testing.T) {
+	value := OneOf(S("x"), P("List")).Rename("Value")
+	list := Seq(S("["), DelimitedSeq(value, S(",")), S("]")).Rename("List")
+	if err := Patch(list); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := WriteDot(&out, list); err != nil {
+		t.Fatal(err)
+	}
+	expected := `digraph grammar {
+	ordering=out;
+	node [fontname="monospace", fontsize=11];
+	edge [fontsize=9];
+	n0 [label="List\nSeq", shape=box, style="bold"];
+	n1 [label="\"[\"", shape=box, style="rounded"];
+	n2 [label="DelimitedSeq 0..*", shape=ellipse];
+	n3 [label="Value\nOneOf", shape=diamond, style="bold"];
+	n4 [label="\"x\"", shape=box, style="rounded"];
+	n5 [label="P(List)", shape=cds, style="dashed"];
+	n6 [label="\",\"", shape=box, style="rounded"];
+	n7 [label="\"]\"", shape=box, style="rounded"];
+	n0 -> n1;
+	n3 -> n4;
+	n5 -> n0 [style=dashed, constraint=false, color="#4060c0"];
+	n3 -> n5;
+	n2 -> n3;
+	n2 -> n6 [label="sep"];
+	n0 -> n2;
+	n0 -> n7;
+}
+`
+	if out.String() != expected {
+		t.Errorf("unexpected graph:\n%s", out.String())
+	}
+}
+
+func TestWriteDotClusters(t *testing.T) {
+	word := OneOrMoreOf(CharRange('a', 'z')).Rename("Word")
+	line := Seq(word, ZeroOrMoreOf(Seq(S(" "), word)), P("End")).Rename("Line")
+	var out bytes.Buffer
+	if err := WriteDotWithOptions(&out, DotOptions{Cluster: true}, Skip(ZeroOrMoreOf(S("\t")), line)); err != nil {
+		t.Fatal(err)
+	}
+	graph := out.String()
+	for _, expected := range []string{
+		"\tn0 [label=\"Skip\", shape=note];\n",
+		"\tsubgraph cluster_3 {\n\t\tlabel=\"Line\";\n\t\tstyle=rounded;\n\t\tn3 [label=\"Line\\nSeq\", shape=box, style=\"bold\"];\n",
+		"\tsubgraph cluster_4 {\n\t\tlabel=\"Word\";\n\t\tstyle=rounded;\n\t\tn4 [label=\"Word\\nOneOrMoreOf\", shape=box, style=\"bold\"];\n\t\tn5 [label=\"1..*\", shape=ellipse];\n\t\tn6 [label=\"[a-z]\", shape=box, style=\"rounded\"];\n\t\tn7 [label=\"0..*\", shape=ellipse];\n\t}\n",
+		"\t\tn11 [label=\"P(End)\\nnot patched\", shape=cds, style=\"dashed\", color=red, fontcolor=red];\n",
+		// the word after a space is the same rule
+		"\tn9 -> n4;\n",
+		"\tn0 -> n1 [label=\"skipper\"];\n",
+	} {
+		if !strings.Contains(graph, expected) {
+			t.Errorf("expected %q in\n%s", expected, graph)
+		}
+	}
+
+	if dot, err := exec.LookPath("dot"); err == nil {
+		cmd := exec.Command(dot, "-Tsvg")
+		cmd.Stdin = strings.NewReader(graph)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Errorf("%v\n%s", err, out)
+		}
+	}
+}
+
+func TestWriteDotRulesThatCantBeCompared(t *testing.T) {
+	var first Parser = firstOf{[]Parser{S("a"), AnyChar()}}
+	var out bytes.Buffer
+	if err := WriteDot(&out, Seq(first, first)); err != nil {
+		t.Fatal(err)
+	}
+	graph := out.String()
+	for _, expected := range []string{
+		"\tn3 [label=\"any character\", shape=box, style=\"rounded\"];\n",
+		// both are the same rule
+		"\tn0 -> n1;\n\tn0 -> n1;\n",
+	} {
+		if !strings.Contains(graph, expected) {
+			t.Errorf("expected %q in\n%s", expected, graph)
+		}
+	}
+}
@@ -0,0 +1,440 @@
+package gopar
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+/*
+WriteEBNF and WriteRailroad document the input a grammar accepts. Every named
+rule gets a production (or a diagram) of its own and everything in between is
+written out inline. Named rules, patched placeholders included, are referred
+to by name, so grammars that refer back to themselves are written out once.
+
+W3C EBNF has nothing for lookahead, regular expressions or Unicode classes,
+so Not and And are written !A and &A, R as /pattern/ and UnicodeClass as
+\p{L}. Skippers and whatever builds values are left out.
+*/
+
+type exportKind int
+
+const (
+	// text is the terminal in EBNF, e.g. 'a' or [a-z]
+	exportTerminal exportKind = iota
+	// text is the name of the rule referred to
+	exportReference
+	exportSequence
+	exportChoice
+	// items[0] or nothing
+	exportOptional
+	// items[0] once or more, separated by items[1] if there is one; text is a
+	// note on how often, e.g. at most 3 times
+	exportRepeat
+	// text is ! or &, items[0] is what's looked for
+	exportLookahead
+	exportEmpty
+)
+
+type exportNode struct {
+	kind  exportKind
+	text  string
+	items []*exportNode
+}
+
+// production is a named rule written out
+type production struct {
+	name string
+	node *exportNode
+}
+
+type exporter struct {
+	// the rules that have a production or are waiting for one
+	added    map[ruleID]bool
+	queue    []Parser
+	inlining map[ruleID]bool
+}
+
+// exportProductions writes out rules and every named rule they get to, in
+// the order they're found
+func exportProductions(rules []Parser) []production {
+	e := &exporter{added: map[ruleID]bool{}, inlining: map[ruleID]bool{}}
+	for _, rule := range rules {
+		e.add(resolve(rule))
+	}
+	var productions []production
+	for i := 0; i < len(e.queue); i++ {
+		rule := e.queue[i]
+		productions = append(productions, production{rule.GetName(), e.describe(rule, true)})
+	}
+	return productions
+}
+
+func (e *exporter) add(rule Parser) {
+	if _, ok := rule.(*placeholderRule); ok || e.added[idOf(rule)] {
+		return
+	}
+	e.added[idOf(rule)] = true
+	e.queue = append(e.queue, rule)
+}
+
+func isProduction(rule Parser) bool {
+	return !isInternalName(rule.GetName()) && !isOneOrMoreOf(rule)
+}
+
+func (e *exporter) describe(rule Parser, top bool) *exportNode {
+	rule = resolve(rule)
+	if placeholder, ok := rule.(*placeholderRule); ok {
+		// unpatched
+		return &exportNode{kind: exportReference, text: placeholder.patchRuleName}
+	}
+	if !top && (isProduction(rule) || e.inlining[idOf(rule)]) {
+		e.add(rule)
+		return &exportNode{kind: exportReference, text: rule.GetName()}
+	}
+	e.inlining[idOf(rule)] = true
+	defer delete(e.inlining, idOf(rule))
+
+	switch rule := rule.(type) {
+	case *stringRule:
+		return literalNode(rule.str, false)
+	case *foldRule:
+		return literalNode(rule.str, true)
+	case *charClassRule:
+		if len(rule.tables) > 0 {
+			return &exportNode{kind: exportTerminal, text: rule.desc}
+		}
+		return &exportNode{kind: exportTerminal, text: ebnfClass(rule.ranges, rule.negate)}
+	case *anyRule:
+		return &exportNode{kind: exportTerminal, text: ebnfClass([]runeRange{{0, unicode.MaxRune}}, false)}
+	case *regexpRule:
+		return &exportNode{kind: exportTerminal, text: fmt.Sprintf("/%s/", rule.pattern)}
+	case *keywordsRule:
+		words := make([]*exportNode, len(rule.words))
+		for i, word := range rule.words {
+			words[i] = literalNode(word, rule.fold)
+		}
+		return choiceNode(words)
+	case *sequenceRule:
+		if repeated, ok := repeatedByOneOrMoreOf(rule); ok {
+			return &exportNode{kind: exportRepeat, items: []*exportNode{e.describe(repeated, false)}}
+		}
+		items := make([]*exportNode, len(rule.subRules))
+		for i, sub := range rule.subRules {
+			items[i] = e.describe(sub, false)
+		}
+		return sequenceNode(items)
+	case *oneOfRule:
+		items := make([]*exportNode, len(rule.subRules))
+		for i, sub := range rule.subRules {
+			items[i] = e.describe(sub, false)
+		}
+		return choiceNode(items)
+	case *atLeastNumOfRule:
+		return repeatNode(e.describe(rule.subRule, false), nil, rule.num, MaxInt)
+	case *asManyAsNumOfRule:
+		return repeatNode(e.describe(rule.subRule, false), nil, 0, rule.num)
+	case *delimitedSeqRule:
+		elem, sep := e.describe(rule.elem, false), e.describe(rule.sep, false)
+		switch rule.trailing {
+		case OptionalTrailing:
+			list := repeatNode(elem, sep, rule.min, rule.max)
+			if list.kind == exportOptional {
+				return &exportNode{kind: exportOptional, items: []*exportNode{sequenceNode([]*exportNode{list.items[0], optionalNode(sep)})}}
+			}
+			return sequenceNode([]*exportNode{list, optionalNode(sep)})
+		case RequiredTrailing:
+			return repeatNode(sequenceNode([]*exportNode{elem, sep}), nil, rule.min, rule.max)
+		}
+		return repeatNode(elem, sep, rule.min, rule.max)
+	case *collectorRule:
+		return e.describe(rule.subRule, false)
+	case *assembleRule:
+		return e.describe(rule.subRule, false)
+	case *tokenRule:
+		return e.describe(rule.subRule, false)
+	case *skipRule:
+		return e.describe(rule.subRule, false)
+	case *notRule:
+		return &exportNode{kind: exportLookahead, text: "!", items: []*exportNode{e.describe(rule.subRule, false)}}
+	case *andRule:
+		return &exportNode{kind: exportLookahead, text: "&", items: []*exportNode{e.describe(rule.subRule, false)}}
+	case *expressionRule:
+		return e.describeExpression(rule)
+	case *offsetRule:
+		return &exportNode{kind: exportEmpty}
+	}
+	// a rule from elsewhere, all that's known is its name
+	return &exportNode{kind: exportReference, text: rule.GetName()}
+}
+
+// describeExpression writes an Expression out as operands separated by infix
+// operators, leaving precedence to the reader
+func (e *exporter) describeExpression(rule *expressionRule) *exportNode {
+	var prefixes, infixes, postfixes []*exportNode
+	for _, op := range rule.operators {
+		node := e.describe(op.op, false)
+		switch op.fixity {
+		case prefix:
+			prefixes = append(prefixes, node)
+		case infix:
+			infixes = append(infixes, node)
+		case postfix:
+			postfixes = append(postfixes, node)
+		}
+	}
+	var unary []*exportNode
+	if len(prefixes) > 0 {
+		unary = append(unary, repeatNode(choiceNode(prefixes), nil, 0, MaxInt))
+	}
+	unary = append(unary, e.describe(rule.operand, false))
+	if len(postfixes) > 0 {
+		unary = append(unary, repeatNode(choiceNode(postfixes), nil, 0, MaxInt))
+	}
+	if len(infixes) == 0 {
+		return sequenceNode(unary)
+	}
+	return repeatNode(sequenceNode(unary), choiceNode(infixes), 1, MaxInt)
+}
+
+func sequenceNode(items []*exportNode) *exportNode {
+	var flat []*exportNode
+	for _, item := range items {
+		switch item.kind {
+		case exportEmpty:
+		case exportSequence:
+			flat = append(flat, item.items...)
+		default:
+			flat = append(flat, item)
+		}
+	}
+	switch len(flat) {
+	case 0:
+		return &exportNode{kind: exportEmpty}
+	case 1:
+		return flat[0]
+	}
+	return &exportNode{kind: exportSequence, items: flat}
+}
+
+func choiceNode(items []*exportNode) *exportNode {
+	if len(items) == 1 {
+		return items[0]
+	}
+	return &exportNode{kind: exportChoice, items: items}
+}
+
+func optionalNode(item *exportNode) *exportNode {
+	return &exportNode{kind: exportOptional, items: []*exportNode{item}}
+}
+
+// repeatNode is item min to max times, separated by sep if it isn't nil
+func repeatNode(item, sep *exportNode, min, max int) *exportNode {
+	if max == 1 {
+		if min == 0 {
+			return optionalNode(item)
+		}
+		return item
+	}
+	repeat := &exportNode{kind: exportRepeat, items: []*exportNode{item}}
+	if sep != nil {
+		repeat.items = append(repeat.items, sep)
+	}
+	switch {
+	case min > 1 && max < MaxInt:
+		repeat.text = fmt.Sprintf("%d to %d times", min, max)
+	case min > 1:
+		repeat.text = fmt.Sprintf("at least %d times", min)
+	case max < MaxInt:
+		repeat.text = fmt.Sprintf("at most %d times", max)
+	}
+	if min == 0 {
+		return optionalNode(repeat)
+	}
+	return repeat
+}
+
+// literalNode quotes str, with the characters that can't be quoted as #xN.
+// Ignoring case, every letter is a class of the ways it can be written.
+func literalNode(str string, fold bool) *exportNode {
+	var pieces []*exportNode
+	var run []rune
+	flush := func() {
+		if len(run) > 0 {
+			quote := "'"
+			if strings.ContainsRune(string(run), '\'') {
+				quote = `"`
+			}
+			pieces = append(pieces, &exportNode{kind: exportTerminal, text: quote + string(run) + quote})
+			run = nil
+		}
+	}
+	for _, r := range str {
+		if fold && unicode.SimpleFold(r) != r {
+			flush()
+			var ranges []runeRange
+			for f := r; ; {
+				ranges = append(ranges, runeRange{f, f})
+				if f = unicode.SimpleFold(f); f == r {
+					break
+				}
+			}
+			pieces = append(pieces, &exportNode{kind: exportTerminal, text: ebnfClass(mergeRanges(ranges), false)})
+			continue
+		}
+		if !unicode.IsPrint(r) {
+			flush()
+			pieces = append(pieces, &exportNode{kind: exportTerminal, text: ebnfRune(r)})
+			continue
+		}
+		// a quote can't hold both kinds of quote
+		if (r == '\'' && strings.ContainsRune(string(run), '"')) || (r == '"' && strings.ContainsRune(string(run), '\'')) {
+			flush()
+		}
+		run = append(run, r)
+	}
+	flush()
+	return sequenceNode(pieces)
+}
+
+func ebnfRune(r rune) string {
+	return fmt.Sprintf("#x%X", r)
+}
+
+// ebnfClass writes ranges as a W3C character class, e.g. [a-z#x20]
+func ebnfClass(ranges []runeRange, negate bool) string {
+	char := func(r rune) string {
+		switch r {
+		case ']', '^', '-', '#', ' ':
+			return ebnfRune(r)
+		}
+		if unicode.IsPrint(r) {
+			return string(r)
+		}
+		return ebnfRune(r)
+	}
+	var class strings.Builder
+	class.WriteString("[")
+	if negate {
+		class.WriteString("^")
+	}
+	for _, rr := range ranges {
+		class.WriteString(char(rr.lo))
+		switch {
+		case rr.hi == rr.lo+1:
+			class.WriteString(char(rr.hi))
+		case rr.hi > rr.lo:
+			class.WriteString("-" + char(rr.hi))
+		}
+	}
+	class.WriteString("]")
+	return class.String()
+}
+
+// precedence is how tightly node holds together in EBNF: alternatives
+// loosest, then sequences, then everything that's a single item
+func (node *exportNode) precedence() int {
+	switch node.kind {
+	case exportChoice:
+		return 0
+	case exportSequence:
+		return 1
+	case exportRepeat:
+		if len(node.items) > 1 || node.text != "" {
+			return 1
+		}
+	case exportOptional:
+		if node.items[0].kind == exportRepeat && node.items[0].precedence() == 1 {
+			return 1
+		}
+	}
+	return 2
+}
+
+// ebnf writes node out, in parentheses if it holds together more loosely
+// than where it goes needs
+func (node *exportNode) ebnf(needs int) string {
+	var s string
+	switch node.kind {
+	case exportTerminal, exportReference:
+		s = node.text
+	case exportEmpty:
+		s = "''"
+	case exportSequence:
+		items := make([]string, len(node.items))
+		for i, item := range node.items {
+			items[i] = item.ebnf(1)
+		}
+		s = strings.Join(items, " ")
+	case exportChoice:
+		items := make([]string, len(node.items))
+		for i, item := range node.items {
+			items[i] = item.ebnf(0)
+		}
+		s = strings.Join(items, " | ")
+	case exportOptional:
+		if item := node.items[0]; item.kind == exportRepeat && len(item.items) == 1 {
+			s = item.items[0].ebnf(2) + "*" + ebnfNote(item.text)
+		} else {
+			s = item.ebnf(2) + "?"
+		}
+	case exportRepeat:
+		item := node.items[0]
+		if len(node.items) > 1 {
+			s = fmt.Sprintf("%s (%s %s)*", item.ebnf(1), node.items[1].ebnf(1), item.ebnf(1))
+		} else {
+			s = item.ebnf(2) + "+"
+		}
+		s += ebnfNote(node.text)
+	case exportLookahead:
+		s = node.text + node.items[0].ebnf(2)
+	}
+	if node.precedence() < needs {
+		return "(" + s + ")"
+	}
+	return s
+}
+
+func ebnfNote(note string) string {
+	if note == "" {
+		return ""
+	}
+	return " /* " + note + " */"
+}
+
+// WriteEBNF writes the grammar made up of rules, and every named rule they
+// use, to w in W3C EBNF notation, one production per rule:
+//
+//	Number ::= Digit+ ('.' Digit+)?
+func WriteEBNF(w io.Writer, rules ...Parser) error {
+	productions := exportProductions(rules)
+	width := 0
+	for _, p := range productions {
+		if len(p.name) > width {
+			width = len(p.name)
+		}
+	}
+	var out strings.Builder
+	for _, p := range productions {
+		out.WriteString(ebnfProduction(p, width))
+		out.WriteString("\n")
+	}
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+// ebnfProduction writes p with its name padded to width, putting long lists
+// of alternatives one to a line
+func ebnfProduction(p production, width int) string {
+	head := fmt.Sprintf("%-*s ::= ", width, p.name)
+	line := head + p.node.ebnf(0)
+	if p.node.kind != exportChoice || len(line) <= 80 {
+		return line
+	}
+	items := make([]string, len(p.node.items))
+	for i, item := range p.node.items {
+		items[i] = item.ebnf(0)
+	}
+	return head + strings.Join(items, "\n"+strings.Repeat(" ", width+3)+"| ")
+}
@@ -0,0 +1,90 @@
+package gopar
+
+import (
+	"bytes"
+	"testing"
+	"unicode"
+)
+
+func expectEBNF(t *testing.T, expected string, rules ...Parser) {
+	t.Helper()
+	var out bytes.Buffer
+	if err := WriteEBNF(&out, rules...); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != expected {
+		t.Errorf("unexpected EBNF:\n%s", out.String())
+	}
+}
+
+func TestWriteEBNF(t *testing.T) {
+	json := jsonGrammar()
+	expectEBNF(t, `Object     ::= '{' (KeyValue (',' KeyValue)*)? '}'
+KeyValue   ::= JsonString ':' Value
+JsonString ::= '"' Char+ '"'
+Value      ::= JsonString | Number | Object | List
+Char       ::= [#x9#xA#x20!#x23-~]
+Number     ::= Digit+ ('.' Digit+)?
+List       ::= '[' (Value (',' Value)*)? ']'
+Digit      ::= [0-9]
+`, json.object)
+
+	rules := compile(t, `
+		Sum  <- Sum '+' Num / Num
+		Num  <- [0-9]+ !'.'
+	`)
+	expectEBNF(t, `Sum ::= Sum '+' Num | Num
+Num ::= [0-9]+ !'.'
+`, rules["Sum"])
+}
+
+func TestWriteEBNFHiddenCycle(t *testing.T) {
+	// a placeholder patched to a rule with an internal name is written out
+	// inline until it comes back around
+	nested := Seq(S("("), ZeroOrOneOf(P("_Nested")), S(")")).Rename("_Nested")
+	if err := Patch(nested); err != nil {
+		t.Fatal(err)
+	}
+	expectEBNF(t, `Parens  ::= '(' _Nested? ')'
+_Nested ::= '(' _Nested? ')'
+`, Seq(nested).Rename("Parens"))
+}
+
+func TestWriteEBNFNotation(t *testing.T) {
+	num := OneOrMoreOf(OneOfChars("0123456789")).Rename("Num")
+	expectEBNF(t, `Expr ::= '-'* Num '!'* (('+' | '*') '-'* Num '!'*)*
+Num  ::= [0-9]+
+`, Expression(num, Prefix(S("-"), 3), Infix(S("+"), 1, LeftAssoc), Infix(S("*"), 2, LeftAssoc), Postfix(S("!"), 4)).Rename("Expr"))
+
+	expectEBNF(t, `Strings ::= [Ssſ] [Tt] [Rr] [Aa] [ßẞ] [Ee] ('<' | '<=' | 'in') "a'b" '"c' #xA /[0-9]+/
+`, Seq(SFold("Straße"), Keywords("<", "<=", "in"), S("a'b\"c\n"), R(`[0-9]+`)).Rename("Strings"))
+
+	expectEBNF(t, `Classes ::= \p{L} [^#x9#x20#x23#x2D#x5D#x5E] [#x0-#x10FFFF] EOF
+EOF     ::= ![#x0-#x10FFFF]
+`, Seq(UnicodeClass(unicode.Letter), NoneOf("]^-# \t"), AnyChar(), EOF()).Rename("Classes"))
+
+	expectEBNF(t, `Counts ::= Num (',' Num)* /* 2 to 5 times */ ','? (Num ';')* 'x'* /* at most 3 times */ 'y'+ /* at least 2 times */
+Num    ::= [0-9]+
+`, Seq(DelimitedSeqOf(num, S(","), 2, 5, OptionalTrailing), DelimitedSeqOf(num, S(";"), 0, MaxInt, RequiredTrailing),
+		AsManyAsNumOf(S("x"), 3), AtLeastNumOf(S("y"), 2)).Rename("Counts"))
+
+	word := OneOrMoreOf(CharRange('a', 'z')).Rename("Word")
+	keyword := Keywords("if", "else").Rename("Keyword")
+	statement := OneOf(Seq(keyword, word), Seq(word, S("="), word), Seq(word, S("+="), word), Seq(word, S("-="), word), Seq(word, S("*="), word)).Rename("Statement")
+	expectEBNF(t, `Statement ::= Keyword Word
+            | Word '=' Word
+            | Word '+=' Word
+            | Word '-=' Word
+            | Word '*=' Word
+Keyword   ::= 'if' | 'else'
+Word      ::= [a-z]+
+`, statement)
+}
+
+func TestWriteEBNFRulesThatCantBeCompared(t *testing.T) {
+	var first Parser = firstOf{[]Parser{S("a"), S("b")}}
+	// all there is to say about a rule from elsewhere is its name
+	expectEBNF(t, `Twice   ::= firstOf firstOf
+firstOf ::= firstOf
+`, Seq(first, first).Rename("Twice"))
+}
@@ -0,0 +1,259 @@
+package gopar
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+/*
+Writing operators as a rule per precedence level gets unwieldy quickly and
+can't express associativity. expressionRule parses operators by binding power
+instead (Pratt parsing): after an operand it takes the next operator only if
+that binds at least as strongly as whatever the operand was found for, and the
+operator's own power decides how much of what follows becomes its right hand
+side.
+*/
+
+// Assoc says how a chain of infix operators of the same power nests.
+type Assoc int
+
+const (
+	// 1-2-3 is (1-2)-3
+	LeftAssoc Assoc = iota
+	// 2^3^4 is 2^(3^4)
+	RightAssoc
+	// a<b<c is an error
+	NonAssoc
+)
+
+type fixity int
+
+const (
+	prefix fixity = iota
+	infix
+	postfix
+)
+
+// Operator is an operator of an Expression, see Prefix, Infix and Postfix.
+// Higher powers bind more strongly.
+type Operator struct {
+	op     Parser
+	power  int
+	assoc  Assoc
+	fixity fixity
+}
+
+// ExprNode is what an Expression pushes for every operator it applied. Op is
+// the text the operator matched and Args are its operands, which are
+// ExprNodes themselves or whatever the operand rule produced.
+type ExprNode struct {
+	Op   string
+	Args []interface{}
+}
+
+// String renders the node as an s-expression, e.g. (+ 1 (* 2 3)).
+func (n *ExprNode) String() string {
+	parts := []string{n.Op}
+	for _, arg := range n.Args {
+		parts = append(parts, fmt.Sprint(arg))
+	}
+	return "(" + strings.Join(parts, " ") + ")"
+}
+
+type expressionRule struct {
+	operand   Parser
+	operators []Operator
+	name      string
+}
+
+func (rule *expressionRule) Parse(input *ThreadSafeBufferedReader) error {
+	if input.state.outermost() {
+		return parseRule(rule, input)
+	}
+	start := input.Offset()
+	value, err := rule.parseExpr(input, 0)
+	if err != nil {
+		switch err := err.(type) {
+		default:
+			return err
+		case ParseError:
+			return err.within(frameOf(rule, start))
+		}
+	}
+	input.stack.Push(value)
+	return nil
+}
+
+// parseExpr parses an expression made of operators of at least minPower
+func (rule *expressionRule) parseExpr(input *ThreadSafeBufferedReader, minPower int) (interface{}, error) {
+	left, err := rule.parseUnary(input)
+	if err != nil {
+		return nil, err
+	}
+	// the power of the non-associative operator left was built with, if any
+	nonAssoc := -1
+outer:
+	for {
+		for _, op := range rule.operators {
+			if op.fixity == prefix || op.power < minPower {
+				continue
+			}
+			opStart, text, opInput, err := rule.matchOperator(op, input)
+			if err != nil {
+				return nil, err
+			}
+			if opInput == nil {
+				continue
+			}
+			if op.fixity == postfix {
+				input.Done()
+				*input = *opInput
+				left = &ExprNode{text, []interface{}{left}}
+				nonAssoc = -1
+				continue outer
+			}
+			if op.assoc == NonAssoc && op.power == nonAssoc {
+				opInput.Done()
+				return nil, ParseError{
+					Offset: opStart,
+					Msg:    fmt.Sprintf("operator '%s' is non-associative", text),
+				}
+			}
+			rightPower := op.power + 1
+			if op.assoc == RightAssoc {
+				rightPower = op.power
+			}
+			right, err := rule.parseOperand(opInput, text, rightPower)
+			if err != nil {
+				opInput.Done()
+				return nil, err
+			}
+			input.Done()
+			*input = *opInput
+			left = &ExprNode{text, []interface{}{left, right}}
+			nonAssoc = -1
+			if op.assoc == NonAssoc {
+				nonAssoc = op.power
+			}
+			continue outer
+		}
+		return left, nil
+	}
+}
+
+// parseUnary parses an operand along with any prefix operators in front of it
+func (rule *expressionRule) parseUnary(input *ThreadSafeBufferedReader) (interface{}, error) {
+	for _, op := range rule.operators {
+		if op.fixity != prefix {
+			continue
+		}
+		_, text, opInput, err := rule.matchOperator(op, input)
+		if err != nil {
+			return nil, err
+		}
+		if opInput == nil {
+			continue
+		}
+		arg, err := rule.parseOperand(opInput, text, op.power)
+		if err != nil {
+			opInput.Done()
+			return nil, err
+		}
+		input.Done()
+		*input = *opInput
+		return &ExprNode{text, []interface{}{arg}}, nil
+	}
+
+	if err := skip(input); err != nil {
+		return nil, err
+	}
+	start := input.Offset()
+	startInput := input.Clone()
+	defer startInput.Done()
+	mark := input.stack.Len()
+	if err := parseRule(rule.operand, input); err != nil {
+		return nil, err
+	}
+	pushed := input.stack.values[mark:]
+	input.stack.values = input.stack.values[:mark]
+	switch len(pushed) {
+	case 0:
+		// nothing to go on but the text
+		matched := make([]byte, input.Offset()-start)
+		if _, err := io.ReadFull(startInput, matched); err != nil {
+			return nil, err
+		}
+		return string(matched), nil
+	case 1:
+		return pushed[0], nil
+	default:
+		return append([]interface{}{}, pushed...), nil
+	}
+}
+
+// parseOperand parses what follows operator text, reporting a missing
+// operand if there's nothing there that could be one
+func (rule *expressionRule) parseOperand(input *ThreadSafeBufferedReader, text string, minPower int) (interface{}, error) {
+	probe := input.Clone()
+	err := skip(probe)
+	operandStart := probe.Offset()
+	probe.Done()
+	if err != nil {
+		return nil, err
+	}
+	value, err := rule.parseExpr(input, minPower)
+	if parseErr, ok := err.(ParseError); ok && parseErr.Offset == operandStart && len(parseErr.Expected) > 0 {
+		return nil, ParseError{
+			Offset: operandStart,
+			Msg:    fmt.Sprintf("missing operand after '%s'", text),
+			Found:  parseErr.Found,
+		}
+	}
+	return value, err
+}
+
+// matchOperator tries op on a clone of input. If op matched it returns where
+// its text starts, the text and the clone, which is past op.
+func (rule *expressionRule) matchOperator(op Operator, input *ThreadSafeBufferedReader) (int, string, *ThreadSafeBufferedReader, error) {
+	opInput := input.Clone()
+	if err := skip(opInput); err != nil {
+		opInput.Done()
+		return 0, "", nil, err
+	}
+	start := opInput.Offset()
+	startInput := opInput.Clone()
+	defer startInput.Done()
+	mark := opInput.stack.Len()
+	if err := parseRule(op.op, opInput); err != nil {
+		backtrack(input.state.running(rule), opInput, err, input.Offset())
+		opInput.Done()
+		if _, ok := err.(ParseError); ok {
+			return 0, "", nil, nil
+		}
+		return 0, "", nil, err
+	}
+	// operators are known by their text
+	opInput.stack.values = opInput.stack.values[:mark]
+	matched := make([]byte, opInput.Offset()-start)
+	if _, err := io.ReadFull(startInput, matched); err != nil {
+		opInput.Done()
+		return 0, "", nil, err
+	}
+	return start, string(matched), opInput, nil
+}
+
+func (rule expressionRule) GetSubRules() []Parser {
+	subRules := []Parser{rule.operand}
+	for _, op := range rule.operators {
+		subRules = append(subRules, op.op)
+	}
+	return subRules
+}
+func (rule expressionRule) GetName() string {
+	return rule.name
+}
+func (rule *expressionRule) Rename(name string) Parser {
+	rule.name = name
+	return rule
+}
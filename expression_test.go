@@ -0,0 +1,115 @@
+package gopar
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func expectExpr(t *testing.T, rule Parser, inText, expected string) {
+	input := NewReader(strings.NewReader(inText))
+	if err := rule.Parse(input); err != nil {
+		t.Errorf("%q: unexpected error: %v", inText, err)
+		return
+	}
+	if input.Offset() != len(inText) {
+		t.Errorf("%q: stopped at offset %d", inText, input.Offset())
+	}
+	if value := fmt.Sprint(input.Stack().Values()...); value != expected {
+		t.Errorf("%q: unexpected value: %s", inText, value)
+	}
+}
+
+func arithmetic() Parser {
+	num := OneOrMoreOf(OneOfChars("0123456789"))
+	atom := OneOf(num, Seq(S("("), P("Expr"), S(")")))
+	expr := Expression(atom,
+		Infix(S("=="), 5, NonAssoc),
+		Infix(S("+"), 10, LeftAssoc),
+		Infix(S("-"), 10, LeftAssoc),
+		Infix(S("*"), 20, LeftAssoc),
+		Infix(S("/"), 20, LeftAssoc),
+		Prefix(S("-"), 30),
+		Infix(S("^"), 40, RightAssoc),
+		Postfix(S("!"), 50),
+	).Rename("Expr")
+	if err := Patch(expr); err != nil {
+		panic(err)
+	}
+	return expr
+}
+
+func TestExpressionPrecedence(t *testing.T) {
+	expr := arithmetic()
+	expectExpr(t, expr, "1", "1")
+	expectExpr(t, expr, "1+2*3", "(+ 1 (* 2 3))")
+	expectExpr(t, expr, "1*2+3", "(+ (* 1 2) 3)")
+	expectExpr(t, expr, "1-2-3", "(- (- 1 2) 3)")
+	expectExpr(t, expr, "2^3^4", "(^ 2 (^ 3 4))")
+	expectExpr(t, expr, "-2^2", "(- (^ 2 2))")
+	expectExpr(t, expr, "-3!", "(- (! 3))")
+	expectExpr(t, expr, "2*-3", "(* 2 (- 3))")
+	expectExpr(t, expr, "1+2==3", "(== (+ 1 2) 3)")
+}
+
+func TestExpressionParentheses(t *testing.T) {
+	expr := arithmetic()
+	// the parenthesized expression pushes its own node, which becomes the
+	// operand's value
+	expectExpr(t, expr, "(1+2)*3", "(* (+ 1 2) 3)")
+	expectExpr(t, expr, "2^(3-1)!", "(^ 2 (! (- 3 1)))")
+}
+
+func TestExpressionErrors(t *testing.T) {
+	expr := arithmetic()
+	expectErr(t, expr, "1+", "error at offset 2 in rule Expr. missing operand after '+'")
+	expectErr(t, expr, "1*-", "error at offset 3 in rule Expr. missing operand after '-'")
+	expectErr(t, expr, "1==2==3", "error at offset 4 in rule Expr. operator '==' is non-associative")
+	expectFurthestErr(t, expr, "1+(2*)", "error at offset 5 (line 1, column 6) in rule Expr>_OneOf>_Sequence>Expr. missing operand after '*'")
+	expectFurthestErr(t, expr, "(1+2", "error at offset 4 (line 1, column 5) in rule Expr>_OneOf>_Sequence>Expr>_OneOf>OneOrMoreOf>>[0-9]. expected one of [0-9], '*', '/', '^', '!', '=', '+', '-', ')' found EOF")
+}
+
+func TestExpressionValues(t *testing.T) {
+	num := Map(Text(OneOrMoreOf(OneOfChars("0123456789"))), func(s string) int {
+		n, _ := strconv.Atoi(s)
+		return n
+	})
+	expr := Skip(ZeroOrMoreOf(S(" ")), Expression(num,
+		Infix(S("+"), 1, LeftAssoc),
+		Infix(S("*"), 2, LeftAssoc),
+	))
+	input := NewReader(strings.NewReader(" 1 + 2 * 3 "))
+	if err := expr.Parse(input); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	node := input.Stack().Pop().(*ExprNode)
+	if node.Op != "+" || node.Args[0] != 1 || node.Args[1].(*ExprNode).Args[1] != 3 {
+		t.Errorf("unexpected node: %s", node)
+	}
+	if input.Offset() != 11 {
+		t.Errorf("unexpected offset: %d", input.Offset())
+	}
+}
+
+func TestExpressionOperatorBacktracks(t *testing.T) {
+	num := OneOrMoreOf(OneOfChars("0123456789"))
+	expr := Expression(num,
+		Infix(S("**"), 20, RightAssoc),
+		Infix(S("*"), 10, LeftAssoc),
+	).Rename("Expr")
+	recorder := &TraceRecorder{}
+	if err := ParseTraced(expr, strings.NewReader("2*3"), recorder); err != nil {
+		t.Fatal(err)
+	}
+	// '**' gets as far as the 3 before '*' is tried instead
+	found := false
+	for _, event := range recorder.Events {
+		if event.Event == "backtrack" && event.Rule == "Expr" && event.From == 2 && event.Offset == 1 {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected Expr to backtrack from 2 to 1: %+v", recorder.Events)
+	}
+}
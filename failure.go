@@ -0,0 +1,151 @@
+package gopar
+
+import (
+	"io"
+	"strings"
+)
+
+/*
+A rule failing doesn't mean much on its own: OneOf tries alternatives that are
+expected to fail and repetitions always end with a failed attempt. The error a
+parse ends with is therefore often not the interesting one; a list that
+couldn't parse its third element makes the enclosing object report that it
+expected a '}'.
+
+So every failure is recorded as it happens and the parse remembers the furthest
+offset any rule failed at, together with everything that was expected there.
+That is what Parse reports.
+*/
+
+// fail records err, which rule returned after starting at start, and returns
+// it. If rule is named and couldn't get past its start, whatever its sub rules
+// expected is replaced by the rule itself; "expected Value" reads better than
+// the list of every way a Value can start. markOffset and expectedMark are
+// the furthest failure from before rule ran.
+func (state *parseState) fail(err ParseError, rule Parser, start, markOffset, expectedMark int) ParseError {
+	if err.Offset > state.failOffset {
+		state.failOffset = err.Offset
+		state.failPath = joinPath(state.path, err.Path...)
+		state.failExpected = append([]string{}, err.Expected...)
+		state.failFound = err.Found
+		state.failMsg = err.Msg
+	} else if err.Offset == state.failOffset {
+		state.failExpected = addExpected(state.failExpected, err.Expected...)
+		if state.failFound == "" {
+			state.failFound = err.Found
+		}
+		if state.failMsg == "" {
+			state.failMsg = err.Msg
+		}
+	}
+
+	// a rule that only got as far as skipping whitespace didn't get past its
+	// start either
+	at := start
+	if state.skippedFrom == start && state.skippedTo == err.Offset {
+		at = err.Offset
+	}
+	name := rule.GetName()
+	if !isInternalName(name) && err.Offset == at && state.failOffset == at {
+		if markOffset != at {
+			expectedMark = 0
+		}
+		if expectedMark == 0 {
+			state.failPath = joinPath(state.path, frameOf(rule, start))
+		}
+		state.failExpected = addExpected(state.failExpected[:expectedMark], name)
+		err.Expected = []string{name}
+	}
+	return err
+}
+
+type savedFailure struct {
+	offset   int
+	path     []Frame
+	expected []string
+	found    string
+	msg      string
+}
+
+func (state *parseState) saveFailure() savedFailure {
+	return savedFailure{state.failOffset, state.failPath, append([]string{}, state.failExpected...), state.failFound, state.failMsg}
+}
+
+func (state *parseState) restoreFailure(saved savedFailure) {
+	state.failOffset = saved.offset
+	state.failPath = saved.path
+	state.failExpected = saved.expected
+	state.failFound = saved.found
+	state.failMsg = saved.msg
+}
+
+func joinPath(path []Frame, more ...Frame) []Frame {
+	return append(path[:len(path):len(path)], more...)
+}
+
+func addExpected(expected []string, more ...string) []string {
+outer:
+	for _, m := range more {
+		for _, e := range expected {
+			if e == m {
+				continue outer
+			}
+		}
+		expected = append(expected, m)
+	}
+	return expected
+}
+
+// report turns a failed parse into the error for the furthest failure.
+// input has to be the reader the parse started with.
+func (state *parseState) report(err error, input *ThreadSafeBufferedReader) error {
+	parseErr, ok := err.(ParseError)
+	if !ok || state.failOffset < 0 {
+		return err
+	}
+	// errors that explain themselves rather than list what was expected,
+	// like a missing operand, are better left alone
+	if parseErr.Offset == state.failOffset && len(parseErr.Expected) == 0 && parseErr.Msg != "" {
+		return locate(parseErr, input)
+	}
+	// nothing was expected when the furthest failure was a Not, so go with
+	// what it said instead, like "unexpected 'b'"
+	msg := state.failMsg
+	if len(state.failExpected) > 0 || msg == "" {
+		expected := "one of " + strings.Join(state.failExpected, ", ")
+		if len(state.failExpected) == 1 {
+			expected = state.failExpected[0]
+		}
+		msg = "expected " + expected
+		if state.failFound != "" {
+			msg += " found " + state.failFound
+		}
+	}
+	return locate(ParseError{
+		Offset:   state.failOffset,
+		Path:     state.failPath,
+		Msg:      msg,
+		Expected: state.failExpected,
+		Found:    state.failFound,
+	}, input)
+}
+
+// Parse parses reader with parser. Unlike parser.Parse, which reports the
+// failure of whichever rule gave up last, Parse reports the furthest offset
+// any rule failed at and everything that was expected there.
+func Parse(parser Parser, reader io.Reader) error {
+	input := NewReader(reader)
+	defer input.Done()
+	return input.state.report(parseRule(parser, input), input)
+}
+
+// ParseAll is Parse but fails unless parser consumed all of reader.
+func ParseAll(parser Parser, reader io.Reader) error {
+	input := NewReader(reader)
+	defer input.Done()
+	err := parseRule(parser, input)
+	if err == nil {
+		err = parseRule(EOF(), input)
+	}
+	return input.state.report(err, input)
+}
@@ -0,0 +1,82 @@
+package gopar
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func expectFurthestErr(t *testing.T, rule Parser, inText, errText string) {
+	err := Parse(rule, strings.NewReader(inText))
+	if err == nil {
+		t.Errorf("expected error, but was none")
+	} else if err.Error() != errText {
+		t.Errorf("unexpected error: message: '%v'", err.Error())
+	}
+}
+
+func TestFurthestFailureInRepetition(t *testing.T) {
+	rule := Seq(ZeroOrMoreOf(Seq(S("a"), S("b"))), S("!"))
+	expectErr(t, rule, "abac!", "error at offset 2 in rule _Sequence>'!'. expected '!' found 'a'")
+	expectFurthestErr(t, rule, "abac!", "error at offset 3 (line 1, column 4) in rule _Sequence>_ZeroOrMoreOf>_Sequence>'b'. expected 'b' found 'c'")
+	if err := Parse(rule, strings.NewReader("abab!")); err != nil {
+		t.Error("unexpected error:", err)
+	}
+}
+
+func TestFurthestFailureExpectedSet(t *testing.T) {
+	rule := Seq(OneOf(S("ab"), S("ac")), ZeroOrOneOf(S("!")), S(";"))
+	expectFurthestErr(t, rule, "ad", "error at offset 1 (line 1, column 2) in rule _Sequence>_OneOf>'ab'. expected one of 'b', 'c' found 'd'")
+	expectFurthestErr(t, rule, "ab", "error at offset 2 (line 1, column 3) in rule _Sequence>_ZeroOrOneOf>'!'. expected one of '!', ';' found EOF")
+
+	err := Parse(rule, strings.NewReader("abx"))
+	if parseErr, ok := err.(ParseError); !ok || !reflect.DeepEqual(parseErr.Expected, []string{"'!'", "';'"}) {
+		t.Errorf("unexpected error: %#v", err)
+	}
+}
+
+func TestFurthestFailureNamesRules(t *testing.T) {
+	value := OneOf(S("1"), S("2")).Rename("Value")
+	rule := Seq(S("["), value, ZeroOrMoreOf(Seq(S(","), value)), S("]"))
+	expectFurthestErr(t, rule, "[x", "error at offset 1 (line 1, column 2) in rule _Sequence>Value. expected Value found 'x'")
+	expectFurthestErr(t, rule, "[1,2,]", "error at offset 5 (line 1, column 6) in rule _Sequence>_ZeroOrMoreOf>_Sequence>Value. expected Value found ']'")
+	// a rule that gets going is not summed up by its name
+	expectFurthestErr(t, Seq(S("["), Seq(S("1"), S("2")).Rename("Twelve")), "[13",
+		"error at offset 2 (line 1, column 3) in rule _Sequence>Twelve>'2'. expected '2' found '3'")
+}
+
+func TestFurthestFailureIgnoresSkipper(t *testing.T) {
+	rule := Skip(ZeroOrMoreOf(S(" ")), Seq(S("a"), S("b")))
+	expectFurthestErr(t, rule, "a c", "error at offset 2 (line 1, column 3) in rule _Skip>_Sequence>'b'. expected 'b' found 'c'")
+}
+
+func TestFurthestFailureNamesRulesAfterSkipping(t *testing.T) {
+	value := OneOf(S("1"), S("2")).Rename("Value")
+	rule := Skip(ZeroOrMoreOf(S(" ")), Seq(S("["), value))
+	expectFurthestErr(t, rule, "[ x", "error at offset 2 (line 1, column 3) in rule _Skip>_Sequence>Value. expected Value found 'x'")
+}
+
+func TestParseAll(t *testing.T) {
+	rule := OneOrMoreOf(Seq(S("a"), ZeroOrOneOf(S("+"))))
+	if err := ParseAll(rule, strings.NewReader("a+a")); err != nil {
+		t.Error("unexpected error:", err)
+	}
+	err := ParseAll(rule, strings.NewReader("a+a-"))
+	if err == nil || err.Error() != "error at offset 3 (line 1, column 4) in rule OneOrMoreOf>>_Sequence>_ZeroOrOneOf>'+'. expected one of '+', 'a', EOF found '-'" {
+		t.Errorf("unexpected error: %v", err)
+	}
+	// Parse is happy with a prefix
+	if err := Parse(rule, strings.NewReader("a+a-")); err != nil {
+		t.Error("unexpected error:", err)
+	}
+}
+
+func TestNotHidesWhatItExpected(t *testing.T) {
+	rule := Seq(Not(S("x")), S("a"))
+	expectFurthestErr(t, rule, "b", "error at offset 0 (line 1, column 1) in rule _Sequence>'a'. expected 'a' found 'b'")
+}
+
+func TestFurthestFailureFromNot(t *testing.T) {
+	rule := Seq(ZeroOrMoreOf(Seq(S("a"), Not(S("b")))), S("c"))
+	expectFurthestErr(t, rule, "abc", "error at offset 1 (line 1, column 2) in rule _Sequence>_ZeroOrMoreOf>_Sequence>_Not. unexpected 'b'")
+}
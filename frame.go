@@ -0,0 +1,129 @@
+package gopar
+
+import (
+	"strings"
+)
+
+// RuleKind says which combinator a rule was built with.
+type RuleKind int
+
+const (
+	KindOther RuleKind = iota
+	KindLiteral
+	KindSequence
+	KindOneOf
+	KindAtLeastNumOf
+	KindAsManyAsNumOf
+	KindPlaceholder
+	KindCollect
+	KindAssemble
+	KindDelimitedSeq
+	KindSkip
+	KindToken
+	KindExpression
+	KindNot
+	KindAnd
+	KindAny
+	KindCharClass
+	KindRegexp
+	KindFoldLiteral
+	KindKeywords
+)
+
+var ruleKindNames = map[RuleKind]string{
+	KindOther:         "other",
+	KindLiteral:       "literal",
+	KindSequence:      "sequence",
+	KindOneOf:         "oneOf",
+	KindAtLeastNumOf:  "atLeastNumOf",
+	KindAsManyAsNumOf: "asManyAsNumOf",
+	KindPlaceholder:   "placeholder",
+	KindCollect:       "collect",
+	KindAssemble:      "assemble",
+	KindDelimitedSeq:  "delimitedSeq",
+	KindSkip:          "skip",
+	KindToken:         "token",
+	KindExpression:    "expression",
+	KindNot:           "not",
+	KindAnd:           "and",
+	KindAny:           "any",
+	KindCharClass:     "charClass",
+	KindRegexp:        "regexp",
+	KindFoldLiteral:   "foldLiteral",
+	KindKeywords:      "keywords",
+}
+
+func (k RuleKind) String() string {
+	return ruleKindNames[k]
+}
+
+func kindOf(rule Parser) RuleKind {
+	switch unwrapRule(rule).(type) {
+	case *stringRule:
+		return KindLiteral
+	case *sequenceRule:
+		return KindSequence
+	case *oneOfRule:
+		return KindOneOf
+	case *atLeastNumOfRule:
+		return KindAtLeastNumOf
+	case *asManyAsNumOfRule:
+		return KindAsManyAsNumOf
+	case *placeholderRule:
+		return KindPlaceholder
+	case *collectorRule:
+		return KindCollect
+	case *assembleRule:
+		return KindAssemble
+	case *delimitedSeqRule:
+		return KindDelimitedSeq
+	case *skipRule:
+		return KindSkip
+	case *tokenRule:
+		return KindToken
+	case *expressionRule:
+		return KindExpression
+	case *notRule:
+		return KindNot
+	case *andRule:
+		return KindAnd
+	case *anyRule:
+		return KindAny
+	case *charClassRule:
+		return KindCharClass
+	case *regexpRule:
+		return KindRegexp
+	case *foldRule:
+		return KindFoldLiteral
+	case *keywordsRule:
+		return KindKeywords
+	}
+	return KindOther
+}
+
+// Frame is one step of the path from the outermost rule down to the rule a
+// ParseError happened in. For literals Name is the quoted literal.
+type Frame struct {
+	Name   string
+	Kind   RuleKind
+	Offset int
+}
+
+func frameOf(rule Parser, start int) Frame {
+	return Frame{rule.GetName(), kindOf(rule), start}
+}
+
+// Internal frames belong to the combinators in api.go rather than to the
+// grammar, see isInternalName.
+func (f Frame) Internal() bool {
+	return f.Kind != KindLiteral && f.Kind != KindFoldLiteral && isInternalName(f.Name)
+}
+
+// RulePath renders Path the way Error does, e.g. "Object>_Sequence>'}'".
+func (p ParseError) RulePath() string {
+	names := make([]string, len(p.Path))
+	for i, frame := range p.Path {
+		names[i] = frame.Name
+	}
+	return strings.Join(names, ">")
+}
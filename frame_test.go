@@ -0,0 +1,55 @@
+package gopar
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestErrorPathFrames(t *testing.T) {
+	value := OneOf(S("1"), S("2")).Rename("Value")
+	rule := Seq(S("["), value, S("]")).Rename("List")
+	err := rule.Parse(NewReader(strings.NewReader("[1,")))
+	parseErr, ok := err.(ParseError)
+	if !ok {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []Frame{
+		{"List", KindSequence, 0},
+		{"']'", KindLiteral, 2},
+	}
+	if !reflect.DeepEqual(parseErr.Path, expected) {
+		t.Errorf("unexpected path: %#v", parseErr.Path)
+	}
+	if parseErr.RulePath() != "List>']'" {
+		t.Errorf("unexpected rule path: %s", parseErr.RulePath())
+	}
+}
+
+func TestErrorPathInternalFrames(t *testing.T) {
+	rule := OneOrMoreOf(Seq(S("a"), S("bc")))
+	err := rule.Parse(NewReader(strings.NewReader("abx")))
+	parseErr, ok := err.(ParseError)
+	if !ok {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// OneOrMoreOf>>_Sequence>'bc' as a string
+	expected := []Frame{
+		{"OneOrMoreOf", KindSequence, 0},
+		{"", KindAtLeastNumOf, 0},
+		{"_Sequence", KindSequence, 0},
+		{"'bc'", KindLiteral, 1},
+	}
+	if !reflect.DeepEqual(parseErr.Path, expected) {
+		t.Errorf("unexpected path: %#v", parseErr.Path)
+	}
+	var names []string
+	for _, frame := range parseErr.Path {
+		if !frame.Internal() {
+			names = append(names, frame.Name)
+		}
+	}
+	if !reflect.DeepEqual(names, []string{"OneOrMoreOf", "'bc'"}) {
+		t.Errorf("unexpected grammar frames: %v", names)
+	}
+}
@@ -0,0 +1,853 @@
+package gopar
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+/*
+Generate writes Go source for a parser that does what a grammar does without
+going through the Parser interface, the reader or the stack: every rule
+becomes a method working on the input as a []byte. Named rules get a method
+of their own and the combinators that make them up get one each too, named
+after the rule they belong to.
+
+The generated parser only recognizes its input. Rules that build values with
+Assemble, Map and friends or with Expression are turned down, and so are left
+recursive rules, which it would recurse on forever. Collect is let through
+since what it collects doesn't change what matches.
+
+For every rule handed to Generate the file has a function like
+
+	func ParseJson(input []byte) (int, error)
+
+returning how much of input the rule matched, or the same error that
+gopar.Parse would have.
+*/
+
+// GenerateOptions control the file Generate writes.
+type GenerateOptions struct {
+	// the package the file belongs to, main if empty
+	Package string
+}
+
+type generator struct {
+	// the method every rule is parsed by
+	funcs map[ruleID]string
+	used  map[string]bool
+	// rules that still need their method written, and the named rule each
+	// belongs to
+	queue  []genItem
+	vars   bytes.Buffer
+	nvars  int
+	regexp bool
+	// the anonymous rules written for each named one so far
+	counts map[string]int
+}
+
+type genItem struct {
+	rule  Parser
+	owner string
+}
+
+// Generate writes a standalone parser for rules to w, see gen.go.
+func Generate(w io.Writer, options GenerateOptions, rules ...Parser) error {
+	g := &generator{funcs: map[ruleID]string{}, used: map[string]bool{}, counts: map[string]int{}}
+	pkg := options.Package
+	if pkg == "" {
+		pkg = "main"
+	}
+	for _, issue := range Validate(rules...) {
+		if issue.Kind == IssueLeftRecursion {
+			return fmt.Errorf("can't generate code for left recursive rules: %s", issue.Msg)
+		}
+	}
+
+	var entries bytes.Buffer
+	entryNames := map[string]bool{}
+	for _, rule := range rules {
+		f, err := g.funcOf(rule, "parse")
+		if err != nil {
+			return err
+		}
+		entry := "Parse" + goIdent(strings.TrimLeft(rule.GetName(), "_"))
+		for n := 2; entryNames[entry]; n++ {
+			entry = fmt.Sprintf("Parse%s%d", goIdent(strings.TrimLeft(rule.GetName(), "_")), n)
+		}
+		entryNames[entry] = true
+		fmt.Fprintf(&entries, "\n// %s parses input as %s and returns how much of it matched.\n", entry, rule.GetName())
+		fmt.Fprintf(&entries, "func %s(input []byte) (int, error) {\n", entry)
+		fmt.Fprintf(&entries, "return newParser(input).parse(%q, (*parser).%s)\n}\n", rule.GetName(), f)
+	}
+
+	var methods bytes.Buffer
+	for len(g.queue) > 0 {
+		item := g.queue[0]
+		g.queue = g.queue[1:]
+		fmt.Fprintf(&methods, "\nfunc (p *parser) %s(pos int) (int, *ParseError) {\n", g.funcs[idOf(item.rule)])
+		if err := g.body(&methods, item.rule, item.owner); err != nil {
+			return err
+		}
+		methods.WriteString("}\n")
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by gopar. DO NOT EDIT.\n\npackage %s\n\nimport (\n", pkg)
+	for _, imp := range []string{"bytes", "fmt", "io", "regexp", "strings", "unicode", "unicode/utf8"} {
+		if imp != "regexp" || g.regexp {
+			fmt.Fprintf(&out, "%q\n", imp)
+		}
+	}
+	out.WriteString(")\n")
+	out.Write(entries.Bytes())
+	out.WriteString(genRuntime)
+	if g.regexp {
+		out.WriteString(genRegexpRuntime)
+	}
+	if g.vars.Len() > 0 {
+		out.WriteString("\nvar (\n")
+		out.Write(g.vars.Bytes())
+		out.WriteString(")\n")
+	}
+	out.Write(methods.Bytes())
+
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		return fmt.Errorf("generated code doesn't compile: %v", err)
+	}
+	_, err = w.Write(src)
+	return err
+}
+
+// resolve finds the rule that actually parses for rule
+func (g *generator) resolve(rule Parser) (Parser, error) {
+	rule = unwrapRule(rule)
+	if placeholder, ok := rule.(*placeholderRule); ok {
+		if placeholder.patchRule == nil {
+			return nil, fmt.Errorf("placeholder '%s' isn't patched", placeholder.patchRuleName)
+		}
+		return g.resolve(placeholder.patchRule)
+	}
+	return rule, nil
+}
+
+// funcOf returns the method rule is parsed by, queueing it up to be written
+// if it's new
+func (g *generator) funcOf(rule Parser, owner string) (string, error) {
+	rule, err := g.resolve(rule)
+	if err != nil {
+		return "", err
+	}
+	if f, ok := g.funcs[idOf(rule)]; ok {
+		return f, nil
+	}
+	var f string
+	if name := rule.GetName(); isInternalName(name) {
+		g.counts[owner]++
+		f = g.unique(fmt.Sprintf("%s_%d", owner, g.counts[owner]))
+	} else {
+		f = g.unique("parse" + goIdent(name))
+		owner = f
+	}
+	g.funcs[idOf(rule)] = f
+	g.queue = append(g.queue, genItem{rule, owner})
+	return f, nil
+}
+
+func (g *generator) unique(f string) string {
+	name := f
+	for n := 2; g.used[name]; n++ {
+		name = fmt.Sprintf("%s%d", f, n)
+	}
+	g.used[name] = true
+	return name
+}
+
+// call is the Go expression that parses sub at the offset in the variable
+// pos the way parseRule would
+func (g *generator) call(sub Parser, owner, pos string) (string, error) {
+	f, err := g.funcOf(sub, owner)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("p.call(%q, %s, (*parser).%s)", sub.GetName(), pos, f), nil
+}
+
+// newVar declares a package level variable holding value and returns its name
+func (g *generator) newVar(prefix, value string) string {
+	g.nvars++
+	name := fmt.Sprintf("%s%d", prefix, g.nvars)
+	fmt.Fprintf(&g.vars, "%s = %s\n", name, value)
+	return name
+}
+
+// body writes the statements of the method for rule
+func (g *generator) body(w *bytes.Buffer, rule Parser, owner string) error {
+	name := strconv.Quote(rule.GetName())
+	// frame is how a leaf rule shows up in error paths
+	frame := func(desc string) string {
+		if isInternalName(rule.GetName()) {
+			return strconv.Quote(desc)
+		}
+		return name
+	}
+	calls := func(subs ...Parser) ([]string, error) {
+		var calls []string
+		for _, sub := range subs {
+			call, err := g.call(sub, owner, "pos")
+			if err != nil {
+				return nil, err
+			}
+			calls = append(calls, call)
+		}
+		return calls, nil
+	}
+
+	switch rule := rule.(type) {
+	default:
+		return fmt.Errorf("can't generate code for rule %s (%T)", rule.GetName(), rule)
+
+	case *stringRule:
+		fmt.Fprintf(w, "return p.literal(pos, %q, %q, false)\n", rule.str, fmt.Sprintf("'%s'", rule.str))
+	case *foldRule:
+		fmt.Fprintf(w, "return p.literal(pos, %q, %q, true)\n", rule.str, fmt.Sprintf("'%s'", rule.str))
+
+	case *sequenceRule:
+		subs, err := calls(rule.subRules...)
+		if err != nil {
+			return err
+		}
+		w.WriteString("var err *ParseError\n")
+		for _, sub := range subs {
+			fmt.Fprintf(w, "if pos, err = %s; err != nil {\nreturn 0, err.within(%s)\n}\n", sub, name)
+		}
+		w.WriteString("return pos, nil\n")
+
+	case *oneOfRule:
+		subs, err := calls(rule.subRules...)
+		if err != nil {
+			return err
+		}
+		w.WriteString("var highest *ParseError\n")
+		for _, sub := range subs {
+			fmt.Fprintf(w, "if end, err := %s; err == nil {\nreturn end, nil\n} else if highest == nil || err.Offset > highest.Offset {\nhighest = err\n}\n", sub)
+		}
+		fmt.Fprintf(w, "return 0, highest.within(%s)\n", name)
+
+	case *atLeastNumOfRule:
+		subs, err := calls(rule.subRule)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "for i := 0; i < %d; i++ {\nvar err *ParseError\nif pos, err = %s; err != nil {\nreturn 0, err.within(%s)\n}\n}\nreturn pos, nil\n", rule.num, subs[0], name)
+
+	case *asManyAsNumOfRule:
+		subs, err := calls(rule.subRule)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "for i := 1; ; i++ {\nend, err := %s\nif err != nil {\nreturn pos, nil\n}\npos = end\nif i >= %s {\nreturn pos, nil\n}\n}\n", subs[0], genInt(rule.num))
+
+	case *collectorRule:
+		subs, err := calls(rule.subRule)
+		if err != nil {
+			return err
+		}
+		// like the interpreter's, the skipper goes before what's collected
+		fmt.Fprintf(w, "pos = p.skip(pos)\nend, err := %s\nif err != nil {\nreturn 0, err.within(%s)\n}\nreturn end, nil\n", subs[0], name)
+
+	case *delimitedSeqRule:
+		elem, err := g.call(rule.elem, owner, "from")
+		if err != nil {
+			return err
+		}
+		sep, err := g.call(rule.sep, owner, "pos")
+		if err != nil {
+			return err
+		}
+		max, min := genInt(rule.max), genInt(rule.min)
+		fmt.Fprintf(w, "count := 0\n// past a separator that may not be followed by an element\nafterSep := -1\n")
+		fmt.Fprintf(w, "for count < %s {\nfrom := pos\nif afterSep >= 0 {\nfrom = afterSep\n}\n", max)
+		fmt.Fprintf(w, "end, err := %s\nif err != nil {\nif count >= %s {\nbreak\n}\nreturn 0, err.within(%s)\n}\n", elem, min, name)
+		fmt.Fprintf(w, "afterSep = -1\npos = end\ncount++\nif count == %s {\nbreak\n}\n", max)
+		fmt.Fprintf(w, "if end, err = %s; err != nil {\nif count >= %s {\nbreak\n}\nreturn 0, err.within(%s)\n}\nafterSep = end\n}\n", sep, min, name)
+		w.WriteString("if afterSep >= 0 {\n")
+		if rule.trailing != NoTrailing {
+			w.WriteString("pos = afterSep\n")
+		}
+		w.WriteString("return pos, nil\n}\n")
+		if rule.trailing == NoTrailing {
+			w.WriteString("return pos, nil\n")
+			break
+		}
+		fmt.Fprintf(w, "if count == 0 {\nreturn pos, nil\n}\nend, err := %s\nif err != nil {\n", sep)
+		if rule.trailing == OptionalTrailing {
+			w.WriteString("return pos, nil\n")
+		} else {
+			fmt.Fprintf(w, "return 0, err.within(%s)\n", name)
+		}
+		w.WriteString("}\nreturn end, nil\n")
+
+	case *skipRule:
+		skipper, err := g.funcOf(rule.skipper, owner)
+		if err != nil {
+			return err
+		}
+		subs, err := calls(rule.subRule)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "skipper, skipperName := p.skipper, p.skipperName\np.skipper, p.skipperName = (*parser).%s, %q\n", skipper, rule.skipper.GetName())
+		fmt.Fprintf(w, "end, err := %s\nif err == nil {\nend = p.skip(end)\n}\np.skipper, p.skipperName = skipper, skipperName\n", subs[0])
+		fmt.Fprintf(w, "if err != nil {\nreturn 0, err.within(%s)\n}\nreturn end, nil\n", name)
+
+	case *tokenRule:
+		subs, err := calls(rule.subRule)
+		if err != nil {
+			return err
+		}
+		w.WriteString("pos = p.skip(pos)\nskipper, skipperName := p.skipper, p.skipperName\np.skipper, p.skipperName = nil, \"\"\n")
+		fmt.Fprintf(w, "end, err := %s\np.skipper, p.skipperName = skipper, skipperName\n", subs[0])
+		fmt.Fprintf(w, "if err != nil {\nreturn 0, err.within(%s)\n}\nreturn end, nil\n", name)
+
+	case *notRule:
+		subs, err := calls(rule.subRule)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "saved := p.saveFailure()\n_, err := %s\np.restoreFailure(saved)\n", subs[0])
+		fmt.Fprintf(w, "if err == nil {\nreturn 0, p.unexpected(pos, %s)\n}\nreturn pos, nil\n", name)
+
+	case *andRule:
+		subs, err := calls(rule.subRule)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "if _, err := %s; err != nil {\nreturn 0, err.within(%s)\n}\nreturn pos, nil\n", subs[0], name)
+
+	case *anyRule:
+		fmt.Fprintf(w, "return p.any(pos, %s)\n", name)
+
+	case *charClassRule:
+		var value strings.Builder
+		fmt.Fprintf(&value, "&charClass{\nascii: [2]uint64{%#x, %#x},\n", rule.ascii[0], rule.ascii[1])
+		if len(rule.ranges) > 0 {
+			value.WriteString("ranges: []runeRange{")
+			for _, rr := range rule.ranges {
+				fmt.Fprintf(&value, "{%d, %d}, ", rr.lo, rr.hi)
+			}
+			value.WriteString("},\n")
+		}
+		if len(rule.tables) > 0 {
+			value.WriteString("tables: []*unicode.RangeTable{")
+			for _, table := range rule.tables {
+				expr, err := tableExpr(table)
+				if err != nil {
+					return err
+				}
+				value.WriteString(expr + ", ")
+			}
+			value.WriteString("},\n")
+		}
+		fmt.Fprintf(&value, "negate: %t,\ndesc: %q,\nframe: %s,\n}", rule.negate, rule.desc, frame(rule.desc))
+		fmt.Fprintf(w, "return p.class(pos, %s)\n", g.newVar("class", value.String()))
+
+	case *regexpRule:
+		g.regexp = true
+		desc := fmt.Sprintf("/%s/", rule.pattern)
+		value := fmt.Sprintf("&pattern{regexp.MustCompile(%q), %q}", rule.re.String(), desc)
+		fmt.Fprintf(w, "return p.pattern(pos, %s)\n", g.newVar("pattern", value))
+
+	case *keywordsRule:
+		value := fmt.Sprintf("&keywords{%#v, %t, %s}", rule.words, rule.fold, frame(rule.desc))
+		fmt.Fprintf(w, "return p.keywords(pos, %s)\n", g.newVar("keywords", value))
+	}
+	return nil
+}
+
+// goIdent makes name usable as part of a Go identifier
+func goIdent(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+func genInt(n int) string {
+	if n == MaxInt {
+		return "maxInt"
+	}
+	return strconv.Itoa(n)
+}
+
+// tableExpr is the Go expression for one of the tables in package unicode
+func tableExpr(table *unicode.RangeTable) (string, error) {
+	for _, tables := range []struct {
+		expr   string
+		tables map[string]*unicode.RangeTable
+	}{{"unicode.Categories", unicode.Categories}, {"unicode.Scripts", unicode.Scripts}, {"unicode.Properties", unicode.Properties}} {
+		var found []string
+		for name, t := range tables.tables {
+			if t == table {
+				found = append(found, name)
+			}
+		}
+		if len(found) > 0 {
+			sort.Strings(found)
+			return fmt.Sprintf("%s[%q]", tables.expr, found[0]), nil
+		}
+	}
+	return "", fmt.Errorf("can't generate code for a table that isn't in package unicode")
+}
+
+// genRuntime is what every generated parser needs. It follows parseRule,
+// failure.go and the leaf rules in parser.go; keep them in step.
+const genRuntime = `
+// ParseReader reads all of r and parses it with parse, e.g.
+// ParseReader(ParseJson, os.Stdin).
+func ParseReader(parse func([]byte) (int, error), r io.Reader) (int, error) {
+	input, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	return parse(input)
+}
+
+// ParseError says where and why the input didn't match.
+type ParseError struct {
+	Offset int
+	// from the outermost rule down to the one that failed
+	Path []string
+	Msg  string
+	// what would have been accepted at Offset and what was there instead
+	Expected []string
+	Found    string
+	// 1-based, Column counts runes
+	Line   int
+	Column int
+}
+
+func (e *ParseError) Error() string {
+	path := strings.Join(e.Path, ">")
+	if e.Line > 0 {
+		return fmt.Sprintf("error at offset %d (line %d, column %d) in rule %s. %s", e.Offset, e.Line, e.Column, path, e.Msg)
+	}
+	return fmt.Sprintf("error at offset %d in rule %s. %s", e.Offset, path, e.Msg)
+}
+
+func (e *ParseError) within(name string) *ParseError {
+	within := *e
+	within.Path = append([]string{name}, e.Path...)
+	return &within
+}
+
+const maxInt = int(^uint(0) >> 1)
+
+type parser struct {
+	input []byte
+	// the rules currently being parsed, outermost first
+	path []string
+	// the furthest failure so far
+	failOffset   int
+	failPath     []string
+	failExpected []string
+	failFound    string
+	failMsg      string
+	// set by Skip rules
+	skipper     func(*parser, int) (int, *ParseError)
+	skipperName string
+	// what skip consumed last
+	skippedFrom, skippedTo int
+}
+
+func newParser(input []byte) *parser {
+	return &parser{input: input, failOffset: -1}
+}
+
+func (p *parser) parse(name string, rule func(*parser, int) (int, *ParseError)) (int, error) {
+	end, err := p.call(name, 0, rule)
+	if err != nil {
+		return 0, p.report(err)
+	}
+	return end, nil
+}
+
+// call runs every rule
+func (p *parser) call(name string, pos int, rule func(*parser, int) (int, *ParseError)) (int, *ParseError) {
+	markOffset, expectedMark := p.failOffset, len(p.failExpected)
+	p.path = append(p.path, name)
+	end, err := rule(p, pos)
+	p.path = p.path[:len(p.path)-1]
+	if err != nil {
+		p.fail(err, name, pos, markOffset, expectedMark)
+		return 0, err
+	}
+	return end, nil
+}
+
+// fail records the furthest failure
+func (p *parser) fail(err *ParseError, name string, start, markOffset, expectedMark int) {
+	if err.Offset > p.failOffset {
+		p.failOffset = err.Offset
+		p.failPath = joinPath(p.path, err.Path...)
+		p.failExpected = append([]string{}, err.Expected...)
+		p.failFound = err.Found
+		p.failMsg = err.Msg
+	} else if err.Offset == p.failOffset {
+		p.failExpected = addExpected(p.failExpected, err.Expected...)
+		if p.failFound == "" {
+			p.failFound = err.Found
+		}
+		if p.failMsg == "" {
+			p.failMsg = err.Msg
+		}
+	}
+
+	at := start
+	if p.skippedFrom == start && p.skippedTo == err.Offset {
+		at = err.Offset
+	}
+	if !isInternalName(name) && err.Offset == at && p.failOffset == at {
+		if markOffset != at {
+			expectedMark = 0
+		}
+		if expectedMark == 0 {
+			p.failPath = joinPath(p.path, name)
+		}
+		p.failExpected = addExpected(p.failExpected[:expectedMark], name)
+		err.Expected = []string{name}
+	}
+}
+
+type savedFailure struct {
+	offset   int
+	path     []string
+	expected []string
+	found    string
+	msg      string
+}
+
+func (p *parser) saveFailure() savedFailure {
+	return savedFailure{p.failOffset, p.failPath, append([]string{}, p.failExpected...), p.failFound, p.failMsg}
+}
+
+func (p *parser) restoreFailure(saved savedFailure) {
+	p.failOffset = saved.offset
+	p.failPath = saved.path
+	p.failExpected = saved.expected
+	p.failFound = saved.found
+	p.failMsg = saved.msg
+}
+
+func joinPath(path []string, more ...string) []string {
+	return append(path[:len(path):len(path)], more...)
+}
+
+func addExpected(expected []string, more ...string) []string {
+outer:
+	for _, m := range more {
+		for _, e := range expected {
+			if e == m {
+				continue outer
+			}
+		}
+		expected = append(expected, m)
+	}
+	return expected
+}
+
+func isInternalName(name string) bool {
+	return name == "" || strings.HasPrefix(name, "_")
+}
+
+// report turns a failed parse into the error for the furthest failure
+func (p *parser) report(err *ParseError) error {
+	if p.failOffset < 0 {
+		return err
+	}
+	if err.Offset == p.failOffset && len(err.Expected) == 0 && err.Msg != "" {
+		return p.locate(err)
+	}
+	// a Not expects nothing, so say what it said
+	msg := p.failMsg
+	if len(p.failExpected) > 0 || msg == "" {
+		expected := "one of " + strings.Join(p.failExpected, ", ")
+		if len(p.failExpected) == 1 {
+			expected = p.failExpected[0]
+		}
+		msg = "expected " + expected
+		if p.failFound != "" {
+			msg += " found " + p.failFound
+		}
+	}
+	return p.locate(&ParseError{
+		Offset:   p.failOffset,
+		Path:     p.failPath,
+		Msg:      msg,
+		Expected: p.failExpected,
+		Found:    p.failFound,
+	})
+}
+
+func (p *parser) locate(err *ParseError) *ParseError {
+	located := *err
+	lineStart := bytes.LastIndexByte(p.input[:err.Offset], '\n') + 1
+	located.Line = bytes.Count(p.input[:lineStart], []byte("\n")) + 1
+	located.Column = 1
+	for _, c := range p.input[lineStart:err.Offset] {
+		if utf8.RuneStart(c) {
+			located.Column++
+		}
+	}
+	return &located
+}
+
+func (p *parser) skip(pos int) int {
+	skipper := p.skipper
+	if skipper == nil {
+		return pos
+	}
+	p.skipper = nil
+	saved := p.saveFailure()
+	from := pos
+	for {
+		end, err := p.call(p.skipperName, pos, skipper)
+		if err != nil || end == pos {
+			break
+		}
+		pos = end
+	}
+	p.restoreFailure(saved)
+	p.skipper = skipper
+	if pos > from {
+		p.skippedFrom, p.skippedTo = from, pos
+	}
+	return pos
+}
+
+func (p *parser) readRune(pos int) (rune, []byte, bool) {
+	if pos >= len(p.input) {
+		return 0, nil, false
+	}
+	r, size := utf8.DecodeRune(p.input[pos:])
+	return r, p.input[pos : pos+size], true
+}
+
+func quoteRune(r rune, raw []byte) string {
+	if r == utf8.RuneError && len(raw) == 1 {
+		return fmt.Sprintf("invalid UTF-8 byte 0x%02x", raw[0])
+	}
+	return fmt.Sprintf("'%c'", r)
+}
+
+func (p *parser) literal(pos int, str, frame string, fold bool) (int, *ParseError) {
+	pos = p.skip(pos)
+	for i := 0; i < len(str); {
+		want, size := utf8.DecodeRuneInString(str[i:])
+		wantRaw := str[i : i+size]
+		i += size
+		expected := []string{quoteRune(want, []byte(wantRaw))}
+		r, raw, ok := p.readRune(pos)
+		if !ok {
+			return 0, &ParseError{Offset: pos, Path: []string{frame}, Msg: "EOF", Expected: expected, Found: "EOF"}
+		}
+		matched := string(raw) == wantRaw
+		if !matched && fold && len(raw) == utf8.RuneLen(r) {
+			matched = foldEqual(r, want)
+		}
+		if !matched {
+			found := quoteRune(r, raw)
+			return 0, &ParseError{Offset: pos, Path: []string{frame}, Msg: "expected " + expected[0] + " found " + found, Expected: expected, Found: found}
+		}
+		pos += len(raw)
+	}
+	return pos, nil
+}
+
+func foldEqual(a, b rune) bool {
+	for r := unicode.SimpleFold(a); r != a; r = unicode.SimpleFold(r) {
+		if r == b {
+			return true
+		}
+	}
+	return a == b
+}
+
+func (p *parser) unexpected(pos int, frame string) *ParseError {
+	found := "EOF"
+	if r, raw, ok := p.readRune(pos); ok {
+		found = quoteRune(r, raw)
+	}
+	return &ParseError{Offset: pos, Path: []string{frame}, Msg: "unexpected " + found, Found: found}
+}
+
+func (p *parser) any(pos int, frame string) (int, *ParseError) {
+	pos = p.skip(pos)
+	_, raw, ok := p.readRune(pos)
+	if !ok {
+		return 0, &ParseError{Offset: pos, Path: []string{frame}, Msg: "EOF", Expected: []string{"any character"}, Found: "EOF"}
+	}
+	return pos + len(raw), nil
+}
+
+type runeRange struct {
+	lo, hi rune
+}
+
+type charClass struct {
+	// ASCII, negation included
+	ascii  [2]uint64
+	ranges []runeRange
+	tables []*unicode.RangeTable
+	negate bool
+	desc   string
+	frame  string
+}
+
+func (c *charClass) matches(r rune) bool {
+	if r < utf8.RuneSelf {
+		return c.ascii[r/64]&(1<<uint(r%64)) != 0
+	}
+	for _, rr := range c.ranges {
+		if rr.lo <= r && r <= rr.hi {
+			return !c.negate
+		}
+	}
+	return unicode.In(r, c.tables...) != c.negate
+}
+
+func (p *parser) class(pos int, c *charClass) (int, *ParseError) {
+	pos = p.skip(pos)
+	r, raw, ok := p.readRune(pos)
+	if !ok {
+		return 0, &ParseError{Offset: pos, Path: []string{c.frame}, Msg: "EOF", Expected: []string{c.desc}, Found: "EOF"}
+	}
+	if !c.matches(r) {
+		found := quoteRune(r, raw)
+		return 0, &ParseError{Offset: pos, Path: []string{c.frame}, Msg: "expected " + c.desc + " found " + found, Expected: []string{c.desc}, Found: found}
+	}
+	return pos + len(raw), nil
+}
+
+type keywords struct {
+	words []string
+	fold  bool
+	frame string
+}
+
+// key is what r is compared as
+func (k *keywords) key(r rune) rune {
+	if !k.fold {
+		return r
+	}
+	min := r
+	for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+		if f < min {
+			min = f
+		}
+	}
+	return min
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// keywords matches the longest of k.words that ends at a word boundary
+func (p *parser) keywords(pos int, k *keywords) (int, *ParseError) {
+	pos = p.skip(pos)
+	end := -1
+	for _, word := range k.words {
+		at := pos
+		matched := true
+		var last rune
+		for _, want := range word {
+			r, raw, ok := p.readRune(at)
+			if !ok || k.key(r) != k.key(want) {
+				matched = false
+				break
+			}
+			at += len(raw)
+			last = r
+		}
+		if !matched || at <= end {
+			continue
+		}
+		if next, _, ok := p.readRune(at); ok && isWordRune(last) && isWordRune(next) {
+			continue
+		}
+		end = at
+	}
+	if end >= 0 {
+		return end, nil
+	}
+
+	expected := make([]string, len(k.words))
+	for i, word := range k.words {
+		expected[i] = "'" + word + "'"
+	}
+	found := p.foundWord(pos)
+	want := "one of " + strings.Join(expected, ", ")
+	if len(expected) == 1 {
+		want = expected[0]
+	}
+	return 0, &ParseError{
+		Offset:   pos,
+		Path:     []string{k.frame},
+		Msg:      "expected " + want + " found " + found,
+		Expected: expected,
+		Found:    found,
+	}
+}
+
+func (p *parser) foundWord(pos int) string {
+	var word []rune
+	for len(word) < 32 {
+		r, raw, ok := p.readRune(pos)
+		if !ok {
+			break
+		}
+		if !isWordRune(r) {
+			if len(word) == 0 {
+				return quoteRune(r, raw)
+			}
+			break
+		}
+		pos += len(raw)
+		word = append(word, r)
+	}
+	if len(word) == 0 {
+		return "EOF"
+	}
+	return "'" + string(word) + "'"
+}
+`
+
+// genRegexpRuntime is only written when there are R rules, so that regexp
+// isn't imported for nothing
+const genRegexpRuntime = `
+type pattern struct {
+	re   *regexp.Regexp
+	desc string
+}
+
+func (p *parser) pattern(pos int, pat *pattern) (int, *ParseError) {
+	pos = p.skip(pos)
+	if loc := pat.re.FindIndex(p.input[pos:]); loc != nil {
+		return pos + loc[1], nil
+	}
+	found := "EOF"
+	if r, raw, ok := p.readRune(pos); ok {
+		found = quoteRune(r, raw)
+	}
+	return 0, &ParseError{Offset: pos, Path: []string{pat.desc}, Msg: "expected " + pat.desc + " found " + found, Expected: []string{pat.desc}, Found: found}
+}
+`
@@ -0,0 +1,177 @@
+package gopar
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode"
+)
+
+type genCase struct {
+	rule   Parser
+	inputs []string
+}
+
+func genCases(t *testing.T) []genCase {
+	json := jsonGrammar()
+	peg := compile(t, pegJson)
+
+	letter := OneOfChars("abcdefghijklmnopqrstuvwxyz").Rename("Letter")
+	comment := OneOf(
+		Seq(S("//"), ZeroOrMoreOf(OneOfChars("abcdefghijklmnopqrstuvwxyz \t")), S("\n")),
+		Seq(S("/*"), ZeroOrMoreOf(OneOfChars("abcdefghijklmnopqrstuvwxyz \t\n")), S("*/")),
+	)
+	skipper := ZeroOrMoreOf(OneOf(OneOfChars(" \t\n"), comment))
+	str := Token(Seq(S("\""), ZeroOrMoreOf(letter), S("\""))).Rename("String")
+
+	letters := OneOrMoreOf(OneOfChars("abcdefghijklmnopqrstuvwxyz"))
+	keyword := Seq(OneOf(S("if"), S("else")), Not(OneOfChars("abcdefghijklmnopqrstuvwxyz")))
+
+	return []genCase{
+		{json.object, []string{`{"a":[1,2.5,{"b":"c"}]}`, `{"a":[1,}`, `{"a"`, `{}x`, ``}},
+		{json.list, []string{`[1,2]`, `[1,2`, `["a" ,1]`}},
+		{peg["Value"].Rename("PegValue"), []string{`{"a":[1,2.5,{"b":"c d"}],"e":{}}`, `{"a":[1,}`, "[1,\n2,\n3.]"}},
+		{Skip(skipper, Seq(S("["), DelimitedSeq(str, S(",")), S("]"))).Rename("SkipList"), []string{
+			` [ "ab" ,"c"  ] `, "[ // the list\n \"ab\", /* comment\n */ \"c\"]\n", `[ "a"  x]`, "[ \"a\" /* */ ", `[ " a"]`,
+		}},
+		{Skip(ZeroOrMoreOf(S(" ")), Seq(KeywordsFold("select"), R(`[a-z]+`), KeywordsFold("from"), R(`[a-z]+`))).Rename("Statement"), []string{
+			"SELECT name From users", "SELECT name FROMusers", "select 1", "selectname from x",
+		}},
+		{Seq(Not(keyword), letters).Rename("Ident"), []string{"iffy", "if", "else", "Else"}},
+		{Seq(ZeroOrMoreOf(Seq(S("a"), Not(S("b")))), S("c")).Rename("NotB"), []string{"aac", "abc", "ab"}},
+		{Seq(And(Seq(letters, S("("))), letters, S("()")).Rename("Call"), []string{"f()", "f", "f(x"}},
+		{Seq(S("a"), EOF()).Rename("A"), []string{"a", "ab", "", "aü", "a\xff"}},
+		{Seq(AnyChar(), EOF()).Rename("AnyOne"), []string{"ü", "üx", ""}},
+		{Seq(UnicodeClass(unicode.Letter), ZeroOrMoreOf(UnicodeClass(unicode.Letter, unicode.Digit))).Rename("UnicodeIdent"), []string{"größe2", "変数", "1x", "a\xff"}},
+		{Seq(S(`"`), ZeroOrMoreOf(OneOf(NoneOf(`"\`), Seq(S(`\`), AnyChar()))), S(`"`)).Rename("Quoted"), []string{`"a \"b\" ü"`, `"a\`, "\"\xe3\x81"}},
+		{Seq(SFold("straße"), Keywords("<", "<=", "in", "int")).Rename("Fold"), []string{"STRASSE<", "STRAẞE<=", "Straßeint", "straßeinte", "strasse"}},
+		{DelimitedSeqOf(OneOfChars("xyz"), S(","), 1, 3, OptionalTrailing).Rename("Optional"), []string{"x,y,", "x,y,z,", "x,y,z,x", ","}},
+		{DelimitedSeqOf(OneOfChars("xyz"), S(","), 2, MaxInt, RequiredTrailing).Rename("Required"), []string{"x,y,", "x,y", "x,", "x,y,z,"}},
+		{Skip(ZeroOrMoreOf(S(" ")), Seq(S("a"), Collect(ZeroOrOneOf(S("b"))), S("c"))).Rename("SkipCollect"), []string{"a b c", "a  c", "a x", "a "}},
+		{Seq(AtLeastNumOf(S("ab"), 2), AsManyAsNumOf(S("c"), 2), Collect(ZeroOrOneOf(S("d")))).Rename("Counts"), []string{"ababccd", "abab", "ab", "ababcccd"}},
+	}
+}
+
+// interpret parses like Parse but also says how far the rule got
+func interpret(rule Parser, inText string) string {
+	input := NewReader(strings.NewReader(inText))
+	defer input.Done()
+	if err := parseRule(rule, input); err != nil {
+		return fmt.Sprintf("0 %v", input.state.report(err, input))
+	}
+	return fmt.Sprintf("%d <nil>", input.Offset())
+}
+
+func TestGenerateMatchesInterpreter(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the generated parser")
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("no go tool")
+	}
+	cases := genCases(t)
+	var rules []Parser
+	for _, c := range cases {
+		rules = append(rules, c.rule)
+	}
+	var parser bytes.Buffer
+	if err := Generate(&parser, GenerateOptions{}, rules...); err != nil {
+		t.Fatal(err)
+	}
+
+	var main, expected strings.Builder
+	main.WriteString("package main\n\nimport \"fmt\"\n\nfunc main() {\n")
+	for _, c := range cases {
+		for _, inText := range c.inputs {
+			fmt.Fprintf(&main, "\tfmt.Println(Parse%s([]byte(%q)))\n", c.rule.GetName(), inText)
+			fmt.Fprintln(&expected, interpret(c.rule, inText))
+		}
+	}
+	main.WriteString("}\n")
+
+	dir := t.TempDir()
+	for name, src := range map[string]string{"parser.go": parser.String(), "main.go": main.String()} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cmd := exec.Command(goTool, "run", "parser.go", "main.go")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GO111MODULE=off", "GOFLAGS=")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+
+	got := strings.Split(string(out), "\n")
+	for i, line := range strings.Split(expected.String(), "\n") {
+		if i >= len(got) {
+			t.Errorf("line %d: generated parser stopped short of\n%q", i+1, line)
+		} else if got[i] != line {
+			t.Errorf("line %d: generated parser gave\n%q\nrather than\n%q", i+1, got[i], line)
+		}
+	}
+}
+
+func TestGenerateRefusesValues(t *testing.T) {
+	var out bytes.Buffer
+	number := Map(Text(OneOrMoreOf(OneOfChars("0123456789"))), func(s string) int { return len(s) })
+	err := Generate(&out, GenerateOptions{}, Seq(S("("), number, S(")")).Rename("Number"))
+	if err == nil || err.Error() != "can't generate code for rule _Map (*gopar.assembleRule)" {
+		t.Errorf("unexpected error: %v", err)
+	}
+	err = Generate(&out, GenerateOptions{}, Seq(S("("), P("Number")).Rename("Paren"))
+	if err == nil || err.Error() != "placeholder 'Number' isn't patched" {
+		t.Errorf("unexpected error: %v", err)
+	}
+	// a rule from elsewhere that can't be compared is turned down too
+	err = Generate(&out, GenerateOptions{}, Seq(firstOf{[]Parser{S("a")}}).Rename("First"))
+	if err == nil || err.Error() != "can't generate code for rule firstOf (gopar.firstOf)" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestGenerateNames(t *testing.T) {
+	var out bytes.Buffer
+	value := OneOf(S("x"), P("List")).Rename("Value")
+	list := Seq(S("["), ZeroOrMoreOf(value), S("]")).Rename("List")
+	if err := Patch(list); err != nil {
+		t.Fatal(err)
+	}
+	if err := Generate(&out, GenerateOptions{Package: "lists"}, list); err != nil {
+		t.Fatal(err)
+	}
+	src := out.String()
+	for _, expected := range []string{
+		"package lists\n",
+		"func ParseList(input []byte) (int, error) {",
+		"func (p *parser) parseList(pos int) (int, *ParseError) {",
+		"func (p *parser) parseList_1(pos int) (int, *ParseError) {",
+		"func (p *parser) parseValue(pos int) (int, *ParseError) {",
+		`p.call("List", pos, (*parser).parseList)`,
+	} {
+		if !strings.Contains(src, expected) {
+			t.Errorf("expected %q in\n%s", expected, src)
+		}
+	}
+	if strings.Contains(src, `"regexp"`) {
+		t.Error("regexp imported for nothing")
+	}
+}
+
+func TestGenerateRefusesLeftRecursion(t *testing.T) {
+	num := OneOrMoreOf(OneOfChars("0123456789")).Rename("Num")
+	sum := OneOf(Seq(P("Sum"), S("+"), num), num).Rename("Sum")
+	if err := Patch(sum); err != nil {
+		t.Fatal(err)
+	}
+	err := Generate(&bytes.Buffer{}, GenerateOptions{}, sum)
+	if err == nil || err.Error() != "can't generate code for left recursive rules: Sum is left recursive: Sum>_Sequence>Sum" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
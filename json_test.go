@@ -1,10 +1,16 @@
 package gopar
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 )
 
-func TestJson(t *testing.T) {
+type jsonRules struct {
+	digit, number, str, keyVal, list, object Parser
+}
+
+func jsonGrammar() jsonRules {
 	digit := OneOfChars("0123456789").Rename("Digit")
 
 	char := OneOfChars(" \t\nabcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789~!@#$%^&*()_+`-={}|[]\\:;'<>?,./'").Rename("Char")
@@ -62,11 +68,17 @@ func TestJson(t *testing.T) {
 
 	err := Patch(object,list)
 	if err != nil {
-		t.Fatal(err)
+		panic(err)
 	}
+	return jsonRules{digit, number, str, keyVal, list, object}
+}
+
+func TestJson(t *testing.T) {
+	json := jsonGrammar()
+	digit, number, str, keyVal, list, object := json.digit, json.number, json.str, json.keyVal, json.list, json.object
 
 	expectNoErr(t, digit, "1")
-	expectErr(t, digit, "a", "error at offset 0 in rule Digit>'0'. expected '0' found 'a'")
+	expectErr(t, digit, "a", "error at offset 0 in rule Digit. expected [0-9] found 'a'")
 	expectNoErr(t, number, "1")
 	expectNoErr(t, number, "12")
 	expectNoErr(t, number, "12.3")
@@ -85,4 +97,57 @@ func TestJson(t *testing.T) {
 	expectNoErr(t, object, `{"apple":"red","banana":[1,2],"coconut":{"a":1,"b":[],"c":{}}}`)
 	expectErr(t, object,   `{"apple":"red","banana":[1,2],"coconut":{"a":1,"b":[,"c":{}}}`,
 		"error at offset 29 in rule Object>'}'. expected '}' found ','")
+	expectFurthestErr(t, object, `{"apple":"red","banana":[1,2],"coconut":{"a":1,"b":[,"c":{}}}`,
+		"error at offset 52 (line 1, column 53) in rule Object>_ZeroOrOneOf>_Sequence>_ZeroOrMoreOf>_Sequence>KeyValue>Value>Object>_ZeroOrOneOf>_Sequence>_ZeroOrMoreOf>_Sequence>KeyValue>Value>List>_ZeroOrOneOf>_Sequence>Value. expected one of Value, ']' found ','")
+}
+
+func TestJsonMemoized(t *testing.T) {
+	object := jsonGrammar().object
+	doc := `{"apple":"red","banana":[1,2],"coconut":{"a":1,"b":[],"c":{}}}`
+	if err := object.Parse(NewReader(strings.NewReader(doc)).Memoize(1000)); err != nil {
+		t.Error("unexpected error:", err)
+	}
+	bad := `{"apple":"red","banana":[1,2],"coconut":{"a":1,"b":[,"c":{}}}`
+	err := object.Parse(NewReader(strings.NewReader(bad)).Memoize(1000))
+	if err == nil || err.Error() != "error at offset 29 in rule Object>'}'. expected '}' found ','" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+// a document with a bit of everything, nested a few levels deep
+func jsonDocument(size int) string {
+	var doc strings.Builder
+	doc.WriteString("{")
+	for i := 0; i < size; i++ {
+		if i > 0 {
+			doc.WriteString(",")
+		}
+		fmt.Fprintf(&doc, `"key%d":{"list":[1,2.5,"three",[],{}],"nested":{"a":[[1],[2,[3]]],"b":"text"}}`, i)
+	}
+	doc.WriteString("}")
+	return doc.String()
+}
+
+func benchmarkJson(b *testing.B, maxEntries int) {
+	object := jsonGrammar().object
+	doc := jsonDocument(20)
+	b.SetBytes(int64(len(doc)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := object.Parse(NewReader(strings.NewReader(doc)).Memoize(maxEntries)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkJson(b *testing.B) {
+	benchmarkJson(b, 0)
+}
+
+func BenchmarkJsonMemoized(b *testing.B) {
+	benchmarkJson(b, 1<<16)
+}
+
+func BenchmarkJsonMemoizedSmallTable(b *testing.B) {
+	benchmarkJson(b, 256)
 }
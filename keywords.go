@@ -0,0 +1,168 @@
+package gopar
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+type keywordNode struct {
+	children map[rune]*keywordNode
+	// a keyword ends here
+	word bool
+}
+
+// keywordsRule matches the longest of its keywords that ends at a word
+// boundary, so that "select" doesn't match the start of "selection".
+// Keywords are looked up in a trie, one rune at a time.
+type keywordsRule struct {
+	root  *keywordNode
+	words []string
+	fold  bool
+	// how error messages refer to the rule, e.g. ('select'|'from')
+	desc string
+	name string
+}
+
+func newKeywords(words []string, fold bool, name string) *keywordsRule {
+	if len(words) == 0 {
+		panic("empty keywordsRule not allowed")
+	}
+	rule := &keywordsRule{root: &keywordNode{}, words: words, fold: fold, name: name}
+	quoted := make([]string, len(words))
+	for i, word := range words {
+		if word == "" {
+			panic("empty keyword not allowed")
+		}
+		node := rule.root
+		for _, r := range word {
+			if node.children == nil {
+				node.children = map[rune]*keywordNode{}
+			}
+			child, ok := node.children[rule.key(r)]
+			if !ok {
+				child = &keywordNode{}
+				node.children[rule.key(r)] = child
+			}
+			node = child
+		}
+		node.word = true
+		quoted[i] = fmt.Sprintf("'%s'", word)
+	}
+	rule.desc = "(" + strings.Join(quoted, "|") + ")"
+	return rule
+}
+
+// key is what r is looked up as in the trie; when folding that's the
+// smallest rune r folds to
+func (rule keywordsRule) key(r rune) rune {
+	if !rule.fold {
+		return r
+	}
+	min := r
+	for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+		if f < min {
+			min = f
+		}
+	}
+	return min
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func (rule keywordsRule) Parse(input *ThreadSafeBufferedReader) error {
+	if err := skip(input); err != nil {
+		return err
+	}
+	start := input.Offset()
+	probe := input.Clone()
+	defer probe.Done()
+	node := rule.root
+	end := -1
+	// whether the keyword so far ends in a letter, digit or '_'; "+" is
+	// happy to be followed by a letter
+	inWord := false
+	for {
+		offset := probe.Offset()
+		r, _, err := probe.readRune()
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if node.word && (err == io.EOF || !inWord || !isWordRune(r)) {
+			end = offset
+		}
+		if err == io.EOF {
+			break
+		}
+		if node = node.children[rule.key(r)]; node == nil {
+			break
+		}
+		inWord = isWordRune(r)
+	}
+	if end >= 0 {
+		input.sbr.advance(input.id, end-start)
+		return nil
+	}
+
+	expected := make([]string, len(rule.words))
+	for i, word := range rule.words {
+		expected[i] = fmt.Sprintf("'%s'", word)
+	}
+	frame := Frame{rule.name, KindKeywords, start}
+	if isInternalName(rule.name) {
+		frame.Name = rule.desc
+	}
+	found := foundWord(input)
+	want := "one of " + strings.Join(expected, ", ")
+	if len(expected) == 1 {
+		want = expected[0]
+	}
+	return ParseError{
+		Offset:   start,
+		Path:     []Frame{frame},
+		Msg:      fmt.Sprintf("expected %s found %s", want, found),
+		Expected: expected,
+		Found:    found,
+	}
+}
+func (rule keywordsRule) GetSubRules() []Parser {
+	return []Parser{}
+}
+func (rule keywordsRule) GetName() string {
+	return rule.name
+}
+func (rule *keywordsRule) Rename(name string) Parser {
+	rule.name = name
+	return rule
+}
+
+// the longest word foundWord quotes in full
+const maxFoundWord = 32
+
+// foundWord quotes the word at the start of input for an error message, or
+// the character there if it isn't the start of a word
+func foundWord(input *ThreadSafeBufferedReader) string {
+	peek := input.Clone()
+	defer peek.Done()
+	var word []rune
+	for len(word) < maxFoundWord {
+		r, raw, err := peek.readRune()
+		if err != nil {
+			break
+		}
+		if !isWordRune(r) {
+			if len(word) == 0 {
+				return quoteRune(r, raw)
+			}
+			break
+		}
+		word = append(word, r)
+	}
+	if len(word) == 0 {
+		return "EOF"
+	}
+	return fmt.Sprintf("'%s'", string(word))
+}
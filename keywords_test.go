@@ -0,0 +1,56 @@
+package gopar
+
+import (
+	"testing"
+)
+
+func TestSFold(t *testing.T) {
+	rule := SFold("select")
+	expectNoErr(t, rule, "select")
+	expectNoErr(t, rule, "SELECT")
+	expectNoErr(t, rule, "SeLeCt")
+	expectErr(t, rule, "selekt", "error at offset 4 in rule 'select'. expected 'c' found 'k'")
+	// simple folding maps K to the Kelvin sign and ſ to s, but doesn't
+	// expand ß to ss
+	expectNoErr(t, SFold("ks"), "Kſ")
+	expectNoErr(t, SFold("straße"), "STRAẞE")
+	expectErr(t, SFold("straße"), "STRASSE", "error at offset 4 in rule 'straße'. expected 'ß' found 'S'")
+	expectNoErr(t, SFold("ÄÖÜ"), "äöü")
+
+	header := Seq(SFold("content-type"), S(":"))
+	expectNoErr(t, header, "Content-Type:")
+}
+
+func TestKeywords(t *testing.T) {
+	rule := Keywords("select", "selection", "from", "<", "<=")
+	expectNoErr(t, rule, "select")
+	expectNoErr(t, rule, "selection")
+	expectNoErr(t, rule, "<=")
+	expectNoErr(t, Seq(rule, S(" x")), "select x")
+	expectNoErr(t, Seq(rule, S("=")), "<==")
+	// punctuation doesn't need a boundary
+	expectNoErr(t, Seq(rule, S("x")), "<x")
+	expectNoErr(t, Seq(rule, S("(")), "from(")
+
+	expectErr(t, rule, "selections", "error at offset 0 in rule ('select'|'selection'|'from'|'<'|'<='). expected one of 'select', 'selection', 'from', '<', '<=' found 'selections'")
+	expectErr(t, rule, "sel", "error at offset 0 in rule ('select'|'selection'|'from'|'<'|'<='). expected one of 'select', 'selection', 'from', '<', '<=' found 'sel'")
+	expectErr(t, rule, "", "error at offset 0 in rule ('select'|'selection'|'from'|'<'|'<='). expected one of 'select', 'selection', 'from', '<', '<=' found EOF")
+	expectErr(t, Seq(S("x"), rule.Rename("Keyword")), "x>", "error at offset 1 in rule _Sequence>Keyword. expected one of 'select', 'selection', 'from', '<', '<=' found '>'")
+
+	// the longest keyword that ends at a boundary wins
+	expectNoErr(t, Seq(Keywords("in", "int"), S(" ")), "int ")
+	expectNoErr(t, Seq(Keywords("in", "inte"), S(" t")), "in t")
+	expectErr(t, Keywords("in", "inte"), "int", "error at offset 0 in rule ('in'|'inte'). expected one of 'in', 'inte' found 'int'")
+}
+
+func TestKeywordsFold(t *testing.T) {
+	statement := Skip(ZeroOrMoreOf(S(" ")), Seq(
+		KeywordsFold("select"),
+		R(`[a-z]+`),
+		KeywordsFold("from"),
+		R(`[a-z]+`),
+	))
+	expectNoErr(t, statement, "SELECT name From users")
+	expectNoErr(t, KeywordsFold("Δ", "σ"), "ς")
+	expectErr(t, statement, "SELECT name FROMusers", "error at offset 12 in rule _Skip>_Sequence>('from'). expected 'from' found 'FROMusers'")
+}
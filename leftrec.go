@@ -0,0 +1,103 @@
+package gopar
+
+/*
+A left recursive rule like
+
+	Sum := OneOf(Seq(P("Sum"), S("+"), Product), Product)
+
+calls itself at the offset it started at and would do so forever. Instead this
+is handled by growing a seed (Warth et al., "Packrat Parsers Can Support Left
+Recursion"): when a placeholder finds the rule it stands for already running
+at the same offset, it fails. The outer call goes on to match the shortest
+Sum, a single Product. That result becomes the seed, and the rule is run again
+with the recursive call replaying the seed instead of failing, which matches a
+longer Sum. This repeats until the match stops getting longer; the longest one
+wins. Since every round wraps the previous one, the result is left
+associative.
+
+Rules running between the placeholder and the outer call make this work for
+indirect left recursion too. The outer call has to go through parseRule; a rule
+whose Parse method is called directly sends itself through it first.
+*/
+
+// activeRule is a rule that is running, see parseState.active
+type activeRule struct {
+	// see memoKeyOf
+	key memoKey
+	// set when a placeholder found this rule to be left recursive
+	seed *seed
+}
+
+type seed struct {
+	key memoKey
+	// holds on to the input from where the rule started
+	start  *ThreadSafeBufferedReader
+	result memoEntry
+}
+
+// leftRecursion is checked before running a placeholder for target. It
+// reports whether target is already running at this offset and if so what the
+// recursive call comes out with.
+func leftRecursion(target Parser, input *ThreadSafeBufferedReader) (bool, error) {
+	state := input.state
+	offset := input.Offset()
+	key := memoKeyOf(target, input)
+	if seed, ok := state.seeds[key]; ok {
+		return true, replay(key, seed.result, input)
+	}
+	for i := len(state.active) - 1; i >= 0 && state.path[i].Offset == offset; i-- {
+		if active := state.active[i]; active.key.rule != key.rule || active.key.skipper != key.skipper {
+			continue
+		}
+		seed := &seed{
+			key:   key,
+			start: input.Clone(),
+			result: memoEntry{err: ParseError{
+				Offset:   offset,
+				Path:     []Frame{frameOf(target, offset)},
+				Msg:      "left recursion",
+				Expected: []string{target.GetName()},
+			}},
+		}
+		state.seeds[key] = seed
+		state.active[i].seed = seed
+		return true, seed.result.err
+	}
+	return false, nil
+}
+
+// grow reruns rule, which turned out to be left recursive, for as long as it
+// matches more input than the last time. err is how the first run went.
+func (state *parseState) grow(rule Parser, input *ThreadSafeBufferedReader, seed *seed, stackMark, nodeMark int, err error) error {
+	defer func() {
+		delete(state.seeds, seed.key)
+		seed.start.Done()
+		// what was remembered here was based on a seed
+		if state.memo != nil {
+			state.memo.forget(seed.key.offset)
+		}
+	}()
+	if err != nil {
+		return err
+	}
+	for {
+		seed.result = resultOf(input, stackMark, nodeMark)
+		if state.memo != nil {
+			state.memo.forget(seed.key.offset)
+		}
+		attempt := seed.start.Clone()
+		attempt.stack = input.stack.clone()
+		attempt.stack.values = attempt.stack.values[:stackMark:stackMark]
+		attempt.nodes = input.nodes[:nodeMark:nodeMark]
+		err := invokeRule(rule, attempt)
+		if err != nil || attempt.Offset() <= input.Offset() {
+			attempt.Done()
+			if _, ok := err.(ParseError); err != nil && !ok {
+				return err
+			}
+			return nil
+		}
+		input.Done()
+		*input = *attempt
+	}
+}
@@ -0,0 +1,105 @@
+package gopar
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestDirectLeftRecursion(t *testing.T) {
+	num := OneOrMoreOf(OneOfChars("0123456789").Rename("_Digit")).Rename("Num")
+	sum := OneOf(Seq(P("Sum"), S("+"), num), num).Rename("Sum")
+	if err := Patch(sum); err != nil {
+		t.Fatal(err)
+	}
+
+	tree, err := ParseTree(sum, strings.NewReader("1+22+3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `Sum(Sum(Sum(Num("1")) Num("22")) Num("3"))`
+	if tree.String() != expected {
+		t.Errorf("unexpected tree: %s", tree)
+	}
+
+	if err := Parse(sum, strings.NewReader("1")); err != nil {
+		t.Error("unexpected error:", err)
+	}
+	input := NewReader(strings.NewReader("1+2+"))
+	if err := parseRule(sum, input); err != nil || input.Offset() != 3 {
+		t.Errorf("unexpected result: offset %d, %v", input.Offset(), err)
+	}
+	err = Parse(sum, strings.NewReader("+1"))
+	if err == nil || err.Error() != "error at offset 0 (line 1, column 1) in rule Sum. expected Sum found '+'" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestLeftRecursionParsedDirectly(t *testing.T) {
+	num := OneOrMoreOf(OneOfChars("0123456789")).Rename("Num")
+	sum := OneOf(Seq(P("Sum"), S("+"), num), num).Rename("Sum")
+	if err := Patch(sum); err != nil {
+		t.Fatal(err)
+	}
+	// calling Parse on the rule grows the seed just like Parse(sum, ...) does
+	for _, text := range []string{"1+2", "1+22+3"} {
+		input := NewReader(strings.NewReader(text))
+		if err := sum.Parse(input); err != nil || input.Offset() != len(text) {
+			t.Errorf("%q: unexpected result: offset %d, %v", text, input.Offset(), err)
+		}
+	}
+}
+
+func TestLeftRecursionIsLeftAssociative(t *testing.T) {
+	num := Map(Text(OneOrMoreOf(OneOfChars("0123456789"))), func(s string) int {
+		n, _ := strconv.Atoi(s)
+		return n
+	})
+	diff := Choice(
+		Seq3(Ref[int]("Diff"), Text(S("-")), num, func(a int, _ string, b int) int { return a - b }),
+		num,
+	).Named("Diff")
+	if err := Patch(diff); err != nil {
+		t.Fatal(err)
+	}
+	expectValue(t, diff, "10-3-2", 5)
+
+	input := NewReader(strings.NewReader("10-3-2-1")).Memoize(100)
+	if value, err := diff.ParseValue(input); err != nil || value != 4 {
+		t.Errorf("unexpected result with memo: %v, %v", value, err)
+	}
+}
+
+func TestIndirectLeftRecursion(t *testing.T) {
+	// A := B "a" / "x" and B := A "b" / "y"
+	a := OneOf(Seq(P("B"), S("a")), S("x")).Rename("A")
+	b := OneOf(Seq(P("A"), S("b")), S("y")).Rename("B")
+	if err := Patch(a, b); err != nil {
+		t.Fatal(err)
+	}
+	for _, inText := range []string{"x", "ya", "xba", "xbaba", "yaba"} {
+		input := NewReader(strings.NewReader(inText))
+		if err := parseRule(a, input); err != nil || input.Offset() != len(inText) {
+			t.Errorf("%q: unexpected result: offset %d, %v", inText, input.Offset(), err)
+		}
+	}
+
+	tree, err := ParseTree(a, strings.NewReader("xba"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree.String() != `A(B(A("x")))` {
+		t.Errorf("unexpected tree: %s", tree)
+	}
+}
+
+func TestLeftRecursionInsideOtherRules(t *testing.T) {
+	num := OneOrMoreOf(OneOfChars("0123456789").Rename("_Digit")).Rename("Num")
+	sum := OneOf(Seq(P("Sum"), S("+"), num), num).Rename("Sum")
+	stmt := Seq(sum, S(";"), ZeroOrOneOf(Seq(sum, S(";"))))
+	if err := Patch(stmt); err != nil {
+		t.Fatal(err)
+	}
+	expectNoErr(t, stmt, "1+2;3+4+5;")
+	expectNoErr(t, stmt, "1;")
+}
@@ -0,0 +1,156 @@
+package gopar
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+/*
+Input that comes from someone else can make a grammar do a lot of work: deeply
+nested brackets recurse as deep as they go, and a OneOf whose alternatives
+share a long prefix reads it again for every one of them. ParseWithOptions
+gives up once a parse goes past its Limits or its context is done.
+
+The limits are checked in parseRule, before every rule runs. Running out
+isn't a ParseError, so no rule takes it for an alternative that didn't match;
+it goes straight back up through every rule, each of them letting go of the
+clones it made on the way. Once the parse has been given up on every rule
+fails right away, and ParseWithOptions drops whatever clones are left along
+with the buffered input.
+*/
+
+// Limits bound the work ParseWithOptions does, zero means no limit.
+type Limits struct {
+	// how deeply rules may be nested
+	MaxDepth int
+	// how many rules may be run altogether
+	MaxSteps int
+	// how many bytes may be backtracked over altogether, which is input that
+	// gets read again
+	MaxBacktrackBytes int
+	// how many bytes of input may be buffered at a time, which is how far
+	// the reader furthest behind is behind the one furthest ahead
+	MaxBuffered int
+}
+
+// The reasons ParseWithOptions gives up for, see AbortError.
+var (
+	ErrDepthExceeded     = errors.New("rules nested too deeply")
+	ErrStepsExceeded     = errors.New("too many rules run")
+	ErrBacktrackExceeded = errors.New("backtracked over too much input")
+	ErrBufferExceeded    = errors.New("too much input buffered")
+	ErrTimeout           = errors.New("timed out")
+	ErrCanceled          = errors.New("canceled")
+)
+
+// AbortError is what ParseWithOptions returns when it gives up. Err is one
+// of ErrDepthExceeded, ErrTimeout and friends; errors.Is sees through to it,
+// and to the context's error for ErrTimeout and ErrCanceled.
+type AbortError struct {
+	Err    error
+	Offset int
+	// the rules that were being parsed, outermost first
+	Path []Frame
+	// what the context was done with, if that's why
+	cause error
+}
+
+func (e AbortError) Error() string {
+	names := make([]string, len(e.Path))
+	for i, frame := range e.Path {
+		names[i] = frame.Name
+	}
+	return fmt.Sprintf("parse aborted at offset %d in rule %s. %s", e.Offset, strings.Join(names, ">"), e.Err)
+}
+
+func (e AbortError) Unwrap() []error {
+	if e.cause != nil {
+		return []error{e.Err, e.cause}
+	}
+	return []error{e.Err}
+}
+
+type limiter struct {
+	Limits
+	ctx                       context.Context
+	depth, steps, backtracked int
+	// why the parse was given up on, once it has been
+	err error
+}
+
+// enter is called before a rule runs, it fails if the rule mustn't
+func (l *limiter) enter(input *ThreadSafeBufferedReader) error {
+	if l.err == nil {
+		l.err = l.check(input)
+	}
+	if l.err != nil {
+		return l.err
+	}
+	l.depth++
+	l.steps++
+	return nil
+}
+
+func (l *limiter) exit() {
+	l.depth--
+}
+
+// backtrack is told that input went back from offset from to offset to
+func (l *limiter) backtrack(input *ThreadSafeBufferedReader, from, to int) {
+	l.backtracked += from - to
+	if l.err == nil && l.MaxBacktrackBytes > 0 && l.backtracked > l.MaxBacktrackBytes {
+		l.err = abort(input, from, ErrBacktrackExceeded, nil)
+	}
+}
+
+func abort(input *ThreadSafeBufferedReader, offset int, err, cause error) error {
+	return AbortError{
+		Err:    err,
+		Offset: offset,
+		Path:   append([]Frame{}, input.state.path...),
+		cause:  cause,
+	}
+}
+
+func (l *limiter) check(input *ThreadSafeBufferedReader) error {
+	select {
+	case <-l.ctx.Done():
+		if l.ctx.Err() == context.DeadlineExceeded {
+			return abort(input, input.Offset(), ErrTimeout, l.ctx.Err())
+		}
+		return abort(input, input.Offset(), ErrCanceled, l.ctx.Err())
+	default:
+	}
+	switch {
+	case l.MaxDepth > 0 && l.depth >= l.MaxDepth:
+		return abort(input, input.Offset(), ErrDepthExceeded, nil)
+	case l.MaxSteps > 0 && l.steps >= l.MaxSteps:
+		return abort(input, input.Offset(), ErrStepsExceeded, nil)
+	case l.MaxBuffered > 0 && input.sbr.buffered() > l.MaxBuffered:
+		return abort(input, input.Offset(), ErrBufferExceeded, nil)
+	}
+	return nil
+}
+
+// ParseWithOptions is Parse, but gives up with an AbortError once ctx is done
+// or the parse goes past limits.
+func ParseWithOptions(ctx context.Context, parser Parser, reader io.Reader, limits Limits) error {
+	return parseLimited(ctx, parser, NewReader(reader), limits)
+}
+
+func parseLimited(ctx context.Context, parser Parser, input *ThreadSafeBufferedReader, limits Limits) error {
+	limiter := &limiter{Limits: limits, ctx: ctx}
+	input.state.limits = limiter
+	err := parseRule(parser, input)
+	// rules that can do without what failed, like ZeroOrMoreOf, may have
+	// matched anyway
+	if limiter.err != nil {
+		input.sbr.release()
+		return limiter.err
+	}
+	defer input.Done()
+	return input.state.report(err, input)
+}
@@ -0,0 +1,90 @@
+package gopar
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func nestedList() Parser {
+	list := P("List")
+	Patch(OneOf(Seq(S("("), ZeroOrMoreOf(list), S(")")), S("x")).Rename("List"), list)
+	return list
+}
+
+func TestParseWithOptions(t *testing.T) {
+	shared := OneOf(Seq(R(`[a-z]+`), S("!")), Seq(R(`[a-z]+`), S("?"))).Rename("Shout")
+	cases := []struct {
+		rule     Parser
+		inText   string
+		limits   Limits
+		expected error
+		msg      string
+	}{
+		{nestedList(), "((x)(x))", Limits{}, nil, ""},
+		{nestedList(), "((((x))))", Limits{MaxDepth: 20}, nil, ""},
+		{nestedList(), "((((x))))", Limits{MaxDepth: 10}, ErrDepthExceeded,
+			"parse aborted at offset 3 in rule List>_Sequence>_ZeroOrMoreOf>List>_Sequence>_ZeroOrMoreOf>List>_Sequence>_ZeroOrMoreOf>List. rules nested too deeply"},
+		{nestedList(), "((x)(x))", Limits{MaxSteps: 10}, ErrStepsExceeded,
+			"parse aborted at offset 2 in rule List>_Sequence>_ZeroOrMoreOf>List>_Sequence>_ZeroOrMoreOf>List>_Sequence. too many rules run"},
+		{shared, "abcdefgh?", Limits{MaxBacktrackBytes: 10}, nil, ""},
+		{ZeroOrMoreOf(shared), "abcdefgh?abcdefgh?", Limits{MaxBacktrackBytes: 10}, ErrBacktrackExceeded,
+			"parse aborted at offset 17 in rule _ZeroOrMoreOf>Shout. backtracked over too much input"},
+		// the OneOf holds on to the input from where its alternatives start
+		{OneOf(Seq(S(strings.Repeat("a", 200)), S("!")), S("a")), strings.Repeat("a", 200) + "?", Limits{MaxBuffered: 100}, ErrBufferExceeded,
+			"parse aborted at offset 200 in rule _OneOf>_Sequence. too much input buffered"},
+		// a rule that never looks back needs next to nothing buffered
+		{ZeroOrMoreOf(S("a")), strings.Repeat("a", 300), Limits{MaxBuffered: 100}, nil, ""},
+	}
+	for _, c := range cases {
+		err := ParseWithOptions(context.Background(), c.rule, strings.NewReader(c.inText), c.limits)
+		if c.expected == nil {
+			if err != nil {
+				t.Errorf("%q: unexpected error %v", c.inText, err)
+			}
+			continue
+		}
+		if !errors.Is(err, c.expected) {
+			t.Errorf("%q: expected %v, got %v", c.inText, c.expected, err)
+			continue
+		}
+		if err.Error() != c.msg {
+			t.Errorf("%q: unexpected message %q", c.inText, err.Error())
+		}
+	}
+}
+
+func TestParseWithOptionsContext(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := ParseWithOptions(canceled, S("a"), strings.NewReader("a"), Limits{})
+	if !errors.Is(err, ErrCanceled) || !errors.Is(err, context.Canceled) {
+		t.Errorf("expected to be canceled, got %v", err)
+	}
+
+	expired, cancel := context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+	err = ParseWithOptions(expired, S("a"), strings.NewReader("a"), Limits{})
+	if !errors.Is(err, ErrTimeout) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected a timeout, got %v", err)
+	}
+
+	// a parse that fails on its own still fails the usual way
+	err = ParseWithOptions(context.Background(), S("a"), strings.NewReader("b"), Limits{MaxSteps: 100})
+	if _, ok := err.(ParseError); !ok {
+		t.Errorf("expected a ParseError, got %v", err)
+	}
+}
+
+func TestParseWithOptionsReleasesReaders(t *testing.T) {
+	input := NewReader(strings.NewReader("((((x))))"))
+	err := parseLimited(context.Background(), nestedList(), input, Limits{MaxDepth: 10})
+	if !errors.Is(err, ErrDepthExceeded) {
+		t.Fatalf("expected %v, got %v", ErrDepthExceeded, err)
+	}
+	if len(input.sbr.globalOffsets) != 0 || len(input.sbr.buffer) != 0 {
+		t.Errorf("readers %v and %d bytes left over", input.sbr.globalOffsets, len(input.sbr.buffer))
+	}
+}
@@ -0,0 +1,195 @@
+package gopar
+
+import (
+	"reflect"
+	"sort"
+	"unsafe"
+)
+
+/*
+OneOf tries its alternatives from the same offset, so when several of them
+start with the same sub rule that sub rule is parsed over and over again; with
+nested choices the work can grow exponentially. Packrat parsing remembers what
+every rule did at every offset and replays it instead.
+
+A result is the offset the rule stopped at, the values it pushed onto the stack
+and the tree nodes it left behind, or the ParseError it failed with. Rules that
+pop values they didn't push themselves depend on what came before them, so
+their results aren't remembered, and neither are those of rules that match a
+literal or a class of characters, which are quicker to run again than to look
+up.
+
+The table is bounded so that it still works on input that doesn't fit in
+memory. Nothing before the reader furthest behind can ever be parsed again, so
+that goes first once the table is full; if that isn't enough the results
+closest to the start of the input go next.
+*/
+
+// ruleID tells rules apart by address, since comparing the rules themselves
+// panics for rules that hold slices or maps.
+type ruleID struct {
+	typ reflect.Type
+	ptr unsafe.Pointer
+}
+
+// iface is how Go lays out an interface: its type and a pointer to its value,
+// or the value itself when that's a pointer
+type iface struct {
+	tab, data unsafe.Pointer
+}
+
+// idOf is rule's address, or for a rule that isn't a pointer the address of
+// the copy its interface holds. Copying the interface around doesn't change
+// either, so a rule has the same id wherever a grammar refers to it.
+func idOf(rule Parser) ruleID {
+	if rule == nil {
+		return ruleID{}
+	}
+	return ruleID{reflect.TypeOf(rule), (*iface)(unsafe.Pointer(&rule)).data}
+}
+
+type memoKey struct {
+	rule    ruleID
+	offset  int
+	skipper ruleID
+}
+
+// memoKeyOf is the key rule's result on input is remembered under
+func memoKeyOf(rule Parser, input *ThreadSafeBufferedReader) memoKey {
+	return memoKey{idOf(memoRule(rule)), input.Offset(), idOf(input.skipper)}
+}
+
+// isLeaf reports whether rule matches input without running other rules
+func isLeaf(rule Parser) bool {
+	switch kindOf(rule) {
+	case KindLiteral, KindFoldLiteral, KindCharClass, KindRegexp, KindAny, KindKeywords:
+		return true
+	}
+	return false
+}
+
+type memoEntry struct {
+	end    int
+	values []interface{}
+	nodes  []*Node
+	err    error
+}
+
+type memo struct {
+	maxEntries int
+	// by offset so whole offsets can go at once
+	entries map[int]map[memoKey]memoEntry
+	size    int
+}
+
+func newMemo(maxEntries int) *memo {
+	return &memo{
+		maxEntries: maxEntries,
+		entries:    map[int]map[memoKey]memoEntry{},
+	}
+}
+
+// memoRule is the rule results are remembered under. A placeholder parses
+// exactly like the rule it was patched with.
+func memoRule(rule Parser) Parser {
+	rule = unwrapRule(rule)
+	if placeholder, ok := rule.(*placeholderRule); ok && placeholder.patchRule != nil {
+		return unwrapRule(placeholder.patchRule)
+	}
+	return rule
+}
+
+// parse runs rule on input unless its result at this offset is remembered.
+func (m *memo) parse(rule Parser, input *ThreadSafeBufferedReader) error {
+	if isLeaf(rule) {
+		return runRule(rule, input)
+	}
+	key := memoKeyOf(rule, input)
+	if entry, ok := m.entries[key.offset][key]; ok {
+		return replay(key, entry, input)
+	}
+	stackMark := input.stack.Len()
+	nodeMark := len(input.nodes)
+	low := input.stack.low
+	input.stack.low = stackMark
+	err := runRule(rule, input)
+	popped := input.stack.low < stackMark
+	if input.stack.low > low {
+		input.stack.low = low
+	}
+	if _, ok := err.(ParseError); !popped && (err == nil || ok) {
+		m.remember(key, input, stackMark, nodeMark, err)
+	}
+	return err
+}
+
+// replay applies what a rule did at key.offset to input, which is there too.
+func replay(key memoKey, entry memoEntry, input *ThreadSafeBufferedReader) error {
+	if entry.err != nil {
+		return entry.err
+	}
+	input.sbr.advance(input.id, entry.end-key.offset)
+	input.stack.own()
+	input.stack.values = append(input.stack.values, entry.values...)
+	input.nodes = append(input.nodes, entry.nodes...)
+	return nil
+}
+
+// remember stores what rule did on input since the stack had stackMark values
+// and there were nodeMark nodes.
+func (m *memo) remember(key memoKey, input *ThreadSafeBufferedReader, stackMark, nodeMark int, err error) {
+	if m.size >= m.maxEntries {
+		m.evict(input.sbr.lowestLiveOffset())
+	}
+	if m.size >= m.maxEntries {
+		return
+	}
+	entry := memoEntry{err: err}
+	if err == nil {
+		entry = resultOf(input, stackMark, nodeMark)
+	}
+	atOffset, ok := m.entries[key.offset]
+	if !ok {
+		atOffset = map[memoKey]memoEntry{}
+		m.entries[key.offset] = atOffset
+	}
+	if _, ok := atOffset[key]; !ok {
+		m.size++
+	}
+	atOffset[key] = entry
+}
+
+func resultOf(input *ThreadSafeBufferedReader, stackMark, nodeMark int) memoEntry {
+	return memoEntry{
+		end:    input.Offset(),
+		values: append([]interface{}{}, input.stack.values[stackMark:]...),
+		nodes:  append([]*Node{}, input.nodes[nodeMark:]...),
+	}
+}
+
+// forget drops everything remembered at offset
+func (m *memo) forget(offset int) {
+	m.size -= len(m.entries[offset])
+	delete(m.entries, offset)
+}
+
+// evict gets the table down to half its size, first by dropping everything
+// before lowest.
+func (m *memo) evict(lowest int) {
+	var offsets []int
+	for offset := range m.entries {
+		if offset < lowest {
+			m.forget(offset)
+		} else {
+			offsets = append(offsets, offset)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(offsets)))
+	kept := 0
+	for _, offset := range offsets {
+		kept += len(m.entries[offset])
+		if kept > m.maxEntries/2 {
+			m.forget(offset)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package gopar
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func memoized(inText string, maxEntries int) *ThreadSafeBufferedReader {
+	return NewReader(strings.NewReader(inText)).Memoize(maxEntries)
+}
+
+func TestMemoSkipsReparsing(t *testing.T) {
+	runs := 0
+	a := Assemble(Collect(S("a")), func(stack *Stack) error {
+		runs++
+		return nil
+	})
+	rule := OneOf(Seq(a, S("b")), Seq(a, S("c")))
+
+	input := NewReader(strings.NewReader("ac"))
+	if err := rule.Parse(input); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if runs != 2 {
+		t.Errorf("expected 2 runs without memo, got %d", runs)
+	}
+
+	runs = 0
+	input = memoized("ac", 100)
+	if err := rule.Parse(input); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if runs != 1 {
+		t.Errorf("expected 1 run with memo, got %d", runs)
+	}
+	if input.Offset() != 2 {
+		t.Errorf("unexpected offset: %d", input.Offset())
+	}
+	if values := input.Stack().Values(); !reflect.DeepEqual(values, []interface{}{"a"}) {
+		t.Errorf("unexpected values: %#v", values)
+	}
+}
+
+func TestMemoRemembersFailures(t *testing.T) {
+	value := OneOf(S("1"), S("2")).Rename("Value")
+	rule := OneOf(Seq(value, S("b")), Seq(value, S("c")))
+	plain := rule.Parse(NewReader(strings.NewReader("1x")))
+	err := rule.Parse(memoized("1x", 100))
+	if err == nil || err.Error() != plain.Error() {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestMemoSkipsRulesThatPopOthersValues(t *testing.T) {
+	// bang pops a value it didn't push, so what it leaves behind depends on
+	// what was parsed before it
+	bang := Assemble(S("!"), func(stack *Stack) error {
+		stack.Push(stack.Pop().(string) + "!")
+		return nil
+	})
+	rule := OneOf(
+		Seq(Collect(S("a")), bang, S("b")),
+		Seq(Collect(S("a")), bang, S("c")),
+	)
+	input := memoized("a!c", 100)
+	if err := rule.Parse(input); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if values := input.Stack().Values(); !reflect.DeepEqual(values, []interface{}{"a!"}) {
+		t.Errorf("unexpected values: %#v", values)
+	}
+}
+
+func TestMemoIsBounded(t *testing.T) {
+	item := OneOf(Seq(S("a"), S("b")), Seq(S("a"), S("c")))
+	rule := Seq(OneOrMoreOf(item), S("!"))
+	input := memoized(strings.Repeat("ab", 500)+"ac!", 16)
+	if err := rule.Parse(input); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if n := input.state.memo.size; n > 16 {
+		t.Errorf("memo grew to %d entries", n)
+	}
+	// the repetition and what's around it only finish at the end
+	for offset := range input.state.memo.entries {
+		if offset > 2 && offset < 900 {
+			t.Errorf("kept entries at offset %d", offset)
+		}
+	}
+}
+
+// firstOf is a rule that isn't a pointer and can't be compared, since it
+// holds a slice
+type firstOf struct {
+	rules []Parser
+}
+
+func (r firstOf) Parse(input *ThreadSafeBufferedReader) error {
+	return OneOf(r.rules...).Parse(input)
+}
+
+func (r firstOf) GetSubRules() []Parser     { return r.rules }
+func (r firstOf) GetName() string           { return "firstOf" }
+func (r firstOf) Rename(name string) Parser { return r }
+
+func TestMemoTakesRulesThatCantBeCompared(t *testing.T) {
+	rule := firstOf{[]Parser{S("a"), S("b")}}
+	if err := OneOf(Seq(rule, S("!")), Seq(rule, S("?"))).Parse(memoized("b?", 100)); err != nil {
+		t.Error("unexpected error:", err)
+	}
+}
+
+func TestRuleIDs(t *testing.T) {
+	// rules that aren't pointers are told apart by the copy their interface
+	// holds
+	a := Parser(firstOf{[]Parser{S("a")}})
+	b := Parser(firstOf{[]Parser{S("a")}})
+	copied := a
+	if idOf(a) != idOf(copied) || idOf(a) == idOf(b) {
+		t.Error("ids don't tell the rules apart")
+	}
+	s := S("a")
+	if idOf(s) != idOf(s) || idOf(s) == idOf(S("a")) {
+		t.Error("ids don't tell the pointers apart")
+	}
+}
+
+// every level tries the same prefix twice, so without a memo the work doubles
+// with every level
+func exponentialGrammar(depth int) Parser {
+	rule := S("x")
+	for i := 0; i < depth; i++ {
+		rule = OneOf(Seq(S("("), rule, S(")"), S("a")), Seq(S("("), rule, S(")")))
+	}
+	return rule
+}
+
+func TestMemoOnExponentialGrammar(t *testing.T) {
+	inText := strings.Repeat("(", 20) + "x" + strings.Repeat(")", 20)
+	if err := exponentialGrammar(20).Parse(memoized(inText, 1000)); err != nil {
+		t.Error("unexpected error:", err)
+	}
+}
+
+func benchmarkExponentialGrammar(b *testing.B, maxEntries int) {
+	rule := exponentialGrammar(12)
+	inText := strings.Repeat("(", 12) + "x" + strings.Repeat(")", 12)
+	for i := 0; i < b.N; i++ {
+		if err := rule.Parse(memoized(inText, maxEntries)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkExponentialGrammar(b *testing.B) {
+	benchmarkExponentialGrammar(b, 0)
+}
+
+func BenchmarkExponentialGrammarMemoized(b *testing.B) {
+	benchmarkExponentialGrammar(b, 1000)
+}
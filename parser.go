@@ -3,16 +3,46 @@ package gopar
 import (
 	"fmt"
 	"io"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 type ParseError struct {
 	Offset int
-	Rule   string
-	Msg    string
+	// from the outermost rule down to the one that failed, see frame.go
+	Path []Frame
+	Msg  string
+	// what would have been accepted at Offset, either literals or the names
+	// of rules that couldn't get started, and what was there instead
+	Expected []string
+	Found    string
+	// 1-based, filled in by Parse and friends when they're known; see
+	// position.go
+	Line       int
+	Column     int
+	RuneColumn int
+	SourceLine string
+	// the column SourceLine starts at, it may have been cut short
+	sourceColumn int
 }
 
 func (p ParseError) Error() string {
-	return fmt.Sprintf("error at offset %d in rule %s. %s", p.Offset, p.Rule, p.Msg)
+	if p.Line > 0 {
+		column := p.RuneColumn
+		if column == 0 {
+			column = p.Column
+		}
+		return fmt.Sprintf("error at offset %d (line %d, column %d) in rule %s. %s", p.Offset, p.Line, column, p.RulePath(), p.Msg)
+	}
+	return fmt.Sprintf("error at offset %d in rule %s. %s", p.Offset, p.RulePath(), p.Msg)
+}
+
+// within prefixes the path of p with the rule it came through
+func (p ParseError) within(frame Frame) ParseError {
+	p.Path = append([]Frame{frame}, p.Path...)
+	return p
 }
 
 // takes input *ThreadSafeBufferedReader and error if bad parse
@@ -23,37 +53,202 @@ type Parser interface {
 	Rename(string) Parser
 }
 
-type stringRule struct {
-	str  string
-	name string
+// parseState is shared by a reader and all of its clones. It holds the
+// bookkeeping for a single parse that isn't tied to a position in the input.
+type parseState struct {
+	buildTree bool
+	// the rules currently being parsed, outermost first
+	path []Frame
+	// see failure.go
+	failOffset   int
+	failPath     []Frame
+	failExpected []string
+	failFound    string
+	failMsg      string
+	// see memo.go, nil unless the reader was told to Memoize
+	memo *memo
+	// see leftrec.go, active lines up with path
+	active []activeRule
+	seeds  map[memoKey]*seed
+	// what skip consumed last
+	skippedFrom, skippedTo int
+	// see trace.go, nil unless the reader was told to Trace, and the rules
+	// parseRule is running, kept only while there's a tracer
+	tracer Tracer
+	traced []Parser
+	// see limits.go, nil unless the parse has limits
+	limits *limiter
 }
 
-func (rule stringRule) Parse(input *ThreadSafeBufferedReader) error {
-	//TODO make this more efficient
-	oneByte := make([]byte, 1)
-	for _, chr := range []byte(rule.str) {
-		_, err := input.Read(oneByte)
+func newParseState() *parseState {
+	return &parseState{failOffset: -1, seeds: map[memoKey]*seed{}}
+}
+
+// parseRule is how rules run their sub rules. Being the one place that sees
+// every rule invocation, it's where per-parse bookkeeping hooks in.
+func parseRule(rule Parser, input *ThreadSafeBufferedReader) error {
+	state := input.state
+	if state.limits != nil {
+		if err := state.limits.enter(input); err != nil {
+			return err
+		}
+		defer state.limits.exit()
+	}
+	start := input.Offset()
+	markOffset, expectedMark := state.failOffset, len(state.failExpected)
+	if state.tracer != nil {
+		state.tracer.Enter(rule, start)
+		state.traced = append(state.traced, rule)
+		defer func() { state.traced = state.traced[:len(state.traced)-1] }()
+	}
+
+	var err error
+	if state.memo != nil {
+		err = state.memo.parse(rule, input)
+	} else {
+		err = runRule(rule, input)
+	}
+	if parseErr, ok := err.(ParseError); ok {
+		err = state.fail(parseErr, rule, start, markOffset, expectedMark)
+	}
+	if state.tracer != nil {
+		end := input.Offset()
+		if parseErr, ok := err.(ParseError); ok {
+			end = parseErr.Offset
+		}
+		state.tracer.Exit(rule, end, err)
+	}
+	return err
+}
+
+// outermost reports whether a rule's Parse was called on it directly rather
+// than through parseRule. Rules that run others go through parseRule then
+// anyway, so that left recursion, the tracer and the limits see them.
+func (state *parseState) outermost() bool {
+	return len(state.path) == 0
+}
+
+// backtrack tells the tracer and the limits, if there are any, that rule is
+// throwing away what abandoned parsed and going back to offset to. Rules call
+// it before letting go of a clone; err is what the clone failed with, if it
+// did, since a failed rule may have read past what it matched.
+func backtrack(rule Parser, abandoned *ThreadSafeBufferedReader, err error, to int) {
+	state := abandoned.state
+	if state.tracer == nil && state.limits == nil {
+		return
+	}
+	from := abandoned.Offset()
+	if parseErr, ok := err.(ParseError); ok {
+		from = parseErr.Offset
+	}
+	if from <= to {
+		return
+	}
+	if state.tracer != nil {
+		state.tracer.Backtrack(rule, from, to)
+	}
+	if state.limits != nil {
+		state.limits.backtrack(abandoned, from, to)
+	}
+}
+
+// running is the rule the tracer was told is running, which is the
+// placeholder or Rule rather than rule when rule was reached through one.
+func (state *parseState) running(rule Parser) Parser {
+	if len(state.traced) == 0 {
+		return rule
+	}
+	return state.traced[len(state.traced)-1]
+}
+
+func runRule(rule Parser, input *ThreadSafeBufferedReader) error {
+	state := input.state
+	if placeholder, ok := unwrapRule(rule).(*placeholderRule); ok && placeholder.patchRule != nil {
+		if recursive, err := leftRecursion(placeholder.patchRule, input); recursive {
+			return err
+		}
+	}
+	start := input.Offset()
+	stackMark := input.stack.Len()
+	nodeMark := len(input.nodes)
+	state.path = append(state.path, frameOf(rule, start))
+	state.active = append(state.active, activeRule{memoKeyOf(rule, input), nil})
+	defer func() {
+		state.path = state.path[:len(state.path)-1]
+		state.active = state.active[:len(state.active)-1]
+	}()
+
+	err := invokeRule(rule, input)
+	if seed := state.active[len(state.active)-1].seed; seed != nil {
+		return state.grow(rule, input, seed, stackMark, nodeMark, err)
+	}
+	return err
+}
+
+func invokeRule(rule Parser, input *ThreadSafeBufferedReader) error {
+	state := input.state
+	// the outermost rule always gets a node so there is a root to return
+	if state.buildTree && (!isInternalName(rule.GetName()) || len(state.path) == 1) {
+		return parseNode(rule, input)
+	}
+	return rule.Parse(input)
+}
+
+// skip consumes whatever the skipper set by an enclosing skipRule matches.
+// Token rules call it before they match anything.
+func skip(input *ThreadSafeBufferedReader) error {
+	skipper := input.skipper
+	if skipper == nil {
+		return nil
+	}
+	// the skipper itself is lexical
+	input.skipper = nil
+	defer func() { input.skipper = skipper }()
+	// the skipper is allowed to fail, what it expected is just noise in the
+	// furthest failure
+	saved := input.state.saveFailure()
+	defer input.state.restoreFailure(saved)
+	from := input.Offset()
+	for {
+		offset := input.Offset()
+		skipInput := input.Clone()
+		err := parseRule(skipper, skipInput)
 		if err != nil {
-			if err == io.EOF {
-				return ParseError{
-					input.Offset(),
-					fmt.Sprintf("'%s'", rule.str),
-					"EOF",
-				}
-			} else {
+			backtrack(skipper, skipInput, err, offset)
+			skipInput.Done()
+			if _, ok := err.(ParseError); !ok {
 				return err
 			}
+			break
 		}
-		if chr != oneByte[0] {
-			return ParseError{
-				input.Offset() - 1,
-				fmt.Sprintf("'%s'", rule.str),
-				fmt.Sprintf("expected '%c' found '%c'", chr, oneByte[0]),
-			}
+		if skipInput.Offset() == offset {
+			skipInput.Done()
+			break
 		}
+		input.Done()
+		*input = *skipInput
+	}
+	// see fail
+	if input.Offset() > from {
+		input.state.skippedFrom, input.state.skippedTo = from, input.Offset()
 	}
 	return nil
 }
+
+// names starting with '_' belong to the combinators in api.go rather than to
+// the grammar
+func isInternalName(name string) bool {
+	return name == "" || strings.HasPrefix(name, "_")
+}
+
+type stringRule struct {
+	str  string
+	name string
+}
+
+func (rule stringRule) Parse(input *ThreadSafeBufferedReader) error {
+	return matchLiteral(input, rule.str, false)
+}
 func (rule stringRule) GetSubRules() []Parser {
 	return []Parser{}
 }
@@ -65,24 +260,110 @@ func (rule *stringRule) Rename(name string) Parser {
 	return rule
 }
 
+// foldRule is a stringRule that ignores case
+type foldRule struct {
+	str  string
+	name string
+}
+
+func (rule foldRule) Parse(input *ThreadSafeBufferedReader) error {
+	return matchLiteral(input, rule.str, true)
+}
+func (rule foldRule) GetSubRules() []Parser {
+	return []Parser{}
+}
+func (rule foldRule) GetName() string {
+	return rule.name
+}
+func (rule *foldRule) Rename(name string) Parser {
+	rule.name = name
+	return rule
+}
+
+// matchLiteral matches str rune by rune, with fold under Unicode simple case
+// folding
+func matchLiteral(input *ThreadSafeBufferedReader, str string, fold bool) error {
+	if err := skip(input); err != nil {
+		return err
+	}
+	start := input.Offset()
+	path := []Frame{{fmt.Sprintf("'%s'", str), KindLiteral, start}}
+	if fold {
+		path[0].Kind = KindFoldLiteral
+	}
+	for i := 0; i < len(str); {
+		want, size := utf8.DecodeRuneInString(str[i:])
+		wantRaw := str[i : i+size]
+		i += size
+		expected := []string{quoteRune(want, []byte(wantRaw))}
+		offset := input.Offset()
+		r, raw, err := input.readRune()
+		if err == io.EOF {
+			return ParseError{
+				Offset:   offset,
+				Path:     path,
+				Msg:      "EOF",
+				Expected: expected,
+				Found:    "EOF",
+			}
+		} else if err != nil {
+			return err
+		}
+		matched := string(raw) == wantRaw
+		if !matched && fold && len(raw) == utf8.RuneLen(r) {
+			matched = foldEqual(r, want)
+		}
+		if !matched {
+			found := quoteRune(r, raw)
+			return ParseError{
+				Offset:   offset,
+				Path:     path,
+				Msg:      fmt.Sprintf("expected %s found %s", expected[0], found),
+				Expected: expected,
+				Found:    found,
+			}
+		}
+	}
+	return nil
+}
+
+// foldEqual is strings.EqualFold for a single rune
+func foldEqual(a, b rune) bool {
+	for r := unicode.SimpleFold(a); r != a; r = unicode.SimpleFold(r) {
+		if r == b {
+			return true
+		}
+	}
+	return a == b
+}
+
+// quoteRune quotes the rune decoded from raw for an error message, or says
+// that raw isn't valid UTF-8
+func quoteRune(r rune, raw []byte) string {
+	if r == utf8.RuneError && len(raw) == 1 {
+		return fmt.Sprintf("invalid UTF-8 byte 0x%02x", raw[0])
+	}
+	return fmt.Sprintf("'%c'", r)
+}
+
 type sequenceRule struct {
 	subRules []Parser
 	name     string
 }
 
-func (rule sequenceRule) Parse(input *ThreadSafeBufferedReader) error {
+func (rule *sequenceRule) Parse(input *ThreadSafeBufferedReader) error {
+	if input.state.outermost() {
+		return parseRule(rule, input)
+	}
+	start := input.Offset()
 	for _, subRule := range rule.subRules {
-		err := subRule.Parse(input)
+		err := parseRule(subRule, input)
 		if err != nil {
 			switch err := err.(type) {
 			default:
 				return err
 			case ParseError:
-				return ParseError{
-					err.Offset,
-					fmt.Sprintf("%s>%s", rule.name, err.Rule),
-					err.Msg,
-				}
+				return err.within(frameOf(rule, start))
 			}
 		}
 	}
@@ -104,23 +385,24 @@ type oneOfRule struct {
 	name     string
 }
 
-func (rule oneOfRule) Parse(input *ThreadSafeBufferedReader) error {
-	var highestErrOffset int = -1
-	errSubRule := ""
-	errSubMsg := ""
+func (rule *oneOfRule) Parse(input *ThreadSafeBufferedReader) error {
+	if input.state.outermost() {
+		return parseRule(rule, input)
+	}
+	start := input.Offset()
+	highestErr := ParseError{Offset: -1}
 	for _, subRule := range rule.subRules {
 		subInput := input.Clone()
-		err := subRule.Parse(subInput)
+		err := parseRule(subRule, subInput)
 		if err != nil {
+			backtrack(input.state.running(rule), subInput, err, start)
 			subInput.Done()
 			switch err := err.(type) {
 			default:
 				return err
 			case ParseError:
-				if err.Offset > highestErrOffset {
-					highestErrOffset = err.Offset
-					errSubRule = err.Rule
-					errSubMsg = err.Msg
+				if err.Offset > highestErr.Offset {
+					highestErr = err
 				}
 			}
 		} else {
@@ -129,11 +411,7 @@ func (rule oneOfRule) Parse(input *ThreadSafeBufferedReader) error {
 			return nil
 		}
 	}
-	return ParseError{
-		highestErrOffset,
-		fmt.Sprintf("%s>%s", rule.name, errSubRule),
-		errSubMsg,
-	}
+	return highestErr.within(frameOf(rule, start))
 }
 func (rule oneOfRule) GetSubRules() []Parser {
 	return rule.subRules
@@ -152,20 +430,20 @@ type atLeastNumOfRule struct {
 	name    string
 }
 
-func (rule atLeastNumOfRule) Parse(input *ThreadSafeBufferedReader) error {
+func (rule *atLeastNumOfRule) Parse(input *ThreadSafeBufferedReader) error {
+	if input.state.outermost() {
+		return parseRule(rule, input)
+	}
+	start := input.Offset()
 	var err error
 	for i := 0; i < rule.num; i++ {
-		err = rule.subRule.Parse(input)
+		err = parseRule(rule.subRule, input)
 		if err != nil {
 			switch err := err.(type) {
 			default:
 				return err
 			case ParseError:
-				return ParseError{
-					err.Offset,
-					fmt.Sprintf("%s>%s", rule.name, err.Rule),
-					err.Msg,
-				}
+				return err.within(frameOf(rule, start))
 			}
 		}
 	}
@@ -188,14 +466,22 @@ type asManyAsNumOfRule struct {
 	name    string
 }
 
-func (rule asManyAsNumOfRule) Parse(input *ThreadSafeBufferedReader) error {
+func (rule *asManyAsNumOfRule) Parse(input *ThreadSafeBufferedReader) error {
+	if input.state.outermost() {
+		return parseRule(rule, input)
+	}
 	var err error
 	subInput := input.Clone()
 	for i := 1; ; i++ {
-		err = rule.subRule.Parse(subInput)
+		err = parseRule(rule.subRule, subInput)
 		if err != nil {
+			backtrack(input.state.running(rule), subInput, err, input.Offset())
 			subInput.Done()
-			return nil
+			if _, ok := err.(ParseError); ok {
+				// the furthest failure has been recorded by parseRule
+				return nil
+			}
+			return err
 		} else {
 			input.Done()
 			*input = *subInput
@@ -224,10 +510,15 @@ type placeholderRule struct {
 	patchRule Parser 
 }
 
-func (rule placeholderRule) Parse(input *ThreadSafeBufferedReader) error {
+func (rule *placeholderRule) Parse(input *ThreadSafeBufferedReader) error {
+	if input.state.outermost() {
+		return parseRule(rule, input)
+	}
 	if rule.patchRule == nil {
 		panic("placeholderRule not patched; use Patch(topLevelParser) to replace these placeholders")
 	}
+	// the placeholder already went through parseRule under the same name, so
+	// go straight to the patched rule
 	return rule.patchRule.Parse(input)
 }
 func (rule placeholderRule) GetSubRules() []Parser {
@@ -243,3 +534,444 @@ func (rule *placeholderRule) Rename(name string) Parser {
 	panic("placeholderRule can not be renamed")
 	return rule
 }
+
+type collectorRule struct {
+	subRule Parser
+	name    string
+}
+
+func (rule *collectorRule) Parse(input *ThreadSafeBufferedReader) error {
+	if input.state.outermost() {
+		return parseRule(rule, input)
+	}
+	// what the skipper matches in front isn't part of what's collected
+	if err := skip(input); err != nil {
+		return err
+	}
+	start := input.Offset()
+	// the clone holds on to the buffer from where the sub rule starts so the
+	// matched bytes can be read back once it's done
+	startInput := input.Clone()
+	defer startInput.Done()
+	err := parseRule(rule.subRule, input)
+	if err != nil {
+		switch err := err.(type) {
+		default:
+			return err
+		case ParseError:
+			return err.within(frameOf(rule, start))
+		}
+	}
+	matched := make([]byte, input.Offset()-start)
+	if _, err := io.ReadFull(startInput, matched); err != nil {
+		return err
+	}
+	input.stack.Push(string(matched))
+	return nil
+}
+func (rule collectorRule) GetSubRules() []Parser {
+	return []Parser{rule.subRule}
+}
+func (rule collectorRule) GetName() string {
+	return rule.name
+}
+func (rule *collectorRule) Rename(name string) Parser {
+	rule.name = name
+	return rule
+}
+
+// assemble is handed the stack length from before subRule ran so it knows
+// which values subRule pushed
+type assembleRule struct {
+	subRule  Parser
+	assemble func(stack *Stack, mark int) error
+	name     string
+}
+
+func (rule *assembleRule) Parse(input *ThreadSafeBufferedReader) error {
+	if input.state.outermost() {
+		return parseRule(rule, input)
+	}
+	start := input.Offset()
+	mark := input.stack.Len()
+	err := parseRule(rule.subRule, input)
+	if err != nil {
+		switch err := err.(type) {
+		default:
+			return err
+		case ParseError:
+			return err.within(frameOf(rule, start))
+		}
+	}
+	return rule.assemble(&input.stack, mark)
+}
+func (rule assembleRule) GetSubRules() []Parser {
+	return []Parser{rule.subRule}
+}
+func (rule assembleRule) GetName() string {
+	return rule.name
+}
+func (rule *assembleRule) Rename(name string) Parser {
+	rule.name = name
+	return rule
+}
+
+// Trailing says what a delimitedSeqRule does about a separator after the last
+// element
+type Trailing int
+
+const (
+	NoTrailing Trailing = iota
+	OptionalTrailing
+	RequiredTrailing
+)
+
+type delimitedSeqRule struct {
+	elem     Parser
+	sep      Parser
+	min      int
+	max      int
+	trailing Trailing
+	name     string
+}
+
+func (rule *delimitedSeqRule) Parse(input *ThreadSafeBufferedReader) error {
+	if input.state.outermost() {
+		return parseRule(rule, input)
+	}
+	start := input.Offset()
+	count := 0
+	// afterSep is past a separator that isn't committed to yet because we
+	// don't know whether an element follows it
+	var afterSep *ThreadSafeBufferedReader
+	for count < rule.max {
+		from := input
+		if afterSep != nil {
+			from = afterSep
+		}
+		elemInput := from.Clone()
+		err := parseRule(rule.elem, elemInput)
+		if err != nil {
+			backtrack(input.state.running(rule), elemInput, err, from.Offset())
+			elemInput.Done()
+			if _, ok := err.(ParseError); ok && count >= rule.min {
+				break
+			}
+			if afterSep != nil {
+				backtrack(input.state.running(rule), afterSep, nil, input.Offset())
+				afterSep.Done()
+			}
+			return rule.wrapError(err, start)
+		}
+		if afterSep != nil {
+			afterSep.Done()
+			afterSep = nil
+		}
+		input.Done()
+		*input = *elemInput
+		count++
+		if count == rule.max {
+			break
+		}
+
+		sepInput := input.Clone()
+		err = parseRule(rule.sep, sepInput)
+		if err != nil {
+			backtrack(input.state.running(rule), sepInput, err, input.Offset())
+			sepInput.Done()
+			if _, ok := err.(ParseError); ok && count >= rule.min {
+				break
+			}
+			return rule.wrapError(err, start)
+		}
+		afterSep = sepInput
+	}
+
+	if afterSep != nil {
+		if rule.trailing == NoTrailing {
+			backtrack(input.state.running(rule), afterSep, nil, input.Offset())
+			afterSep.Done()
+		} else {
+			input.Done()
+			*input = *afterSep
+		}
+		return nil
+	}
+	if count == 0 || rule.trailing == NoTrailing {
+		return nil
+	}
+	// the last element wasn't followed by a separator, either because max
+	// was reached or because there wasn't one
+	sepInput := input.Clone()
+	err := parseRule(rule.sep, sepInput)
+	if err != nil {
+		backtrack(input.state.running(rule), sepInput, err, input.Offset())
+		sepInput.Done()
+		if _, ok := err.(ParseError); ok && rule.trailing == OptionalTrailing {
+			return nil
+		}
+		return rule.wrapError(err, start)
+	}
+	input.Done()
+	*input = *sepInput
+	return nil
+}
+func (rule delimitedSeqRule) wrapError(err error, start int) error {
+	switch err := err.(type) {
+	default:
+		return err
+	case ParseError:
+		return err.within(frameOf(&rule, start))
+	}
+}
+func (rule delimitedSeqRule) GetSubRules() []Parser {
+	return []Parser{rule.elem, rule.sep}
+}
+func (rule delimitedSeqRule) GetName() string {
+	return rule.name
+}
+func (rule *delimitedSeqRule) Rename(name string) Parser {
+	rule.name = name
+	return rule
+}
+
+type skipRule struct {
+	skipper Parser
+	subRule Parser
+	name    string
+}
+
+func (rule *skipRule) Parse(input *ThreadSafeBufferedReader) error {
+	if input.state.outermost() {
+		return parseRule(rule, input)
+	}
+	start := input.Offset()
+	outerSkipper := input.skipper
+	input.skipper = rule.skipper
+	defer func() { input.skipper = outerSkipper }()
+	err := parseRule(rule.subRule, input)
+	if err != nil {
+		switch err := err.(type) {
+		default:
+			return err
+		case ParseError:
+			return err.within(frameOf(rule, start))
+		}
+	}
+	// whatever trails the last token
+	return skip(input)
+}
+func (rule skipRule) GetSubRules() []Parser {
+	return []Parser{rule.skipper, rule.subRule}
+}
+func (rule skipRule) GetName() string {
+	return rule.name
+}
+func (rule *skipRule) Rename(name string) Parser {
+	rule.name = name
+	return rule
+}
+
+type tokenRule struct {
+	subRule Parser
+	name    string
+}
+
+func (rule *tokenRule) Parse(input *ThreadSafeBufferedReader) error {
+	if input.state.outermost() {
+		return parseRule(rule, input)
+	}
+	start := input.Offset()
+	if err := skip(input); err != nil {
+		return err
+	}
+	skipper := input.skipper
+	input.skipper = nil
+	defer func() { input.skipper = skipper }()
+	err := parseRule(rule.subRule, input)
+	if err != nil {
+		switch err := err.(type) {
+		default:
+			return err
+		case ParseError:
+			return err.within(frameOf(rule, start))
+		}
+	}
+	return nil
+}
+func (rule tokenRule) GetSubRules() []Parser {
+	return []Parser{rule.subRule}
+}
+func (rule tokenRule) GetName() string {
+	return rule.name
+}
+func (rule *tokenRule) Rename(name string) Parser {
+	rule.name = name
+	return rule
+}
+
+// notRule succeeds, consuming nothing, where subRule fails
+type notRule struct {
+	subRule Parser
+	name    string
+}
+
+func (rule *notRule) Parse(input *ThreadSafeBufferedReader) error {
+	if input.state.outermost() {
+		return parseRule(rule, input)
+	}
+	start := input.Offset()
+	// subRule is supposed to fail, so what it expected is no help to anyone
+	saved := input.state.saveFailure()
+	probe := input.Clone()
+	err := parseRule(rule.subRule, probe)
+	backtrack(input.state.running(rule), probe, err, start)
+	probe.Done()
+	input.state.restoreFailure(saved)
+	if err == nil {
+		found := "EOF"
+		peek := input.Clone()
+		if r, raw, err := peek.readRune(); err == nil {
+			found = quoteRune(r, raw)
+		}
+		peek.Done()
+		return ParseError{
+			Offset: start,
+			Path:   []Frame{frameOf(rule, start)},
+			Msg:    fmt.Sprintf("unexpected %s", found),
+			Found:  found,
+		}
+	}
+	if _, ok := err.(ParseError); !ok {
+		return err
+	}
+	return nil
+}
+func (rule notRule) GetSubRules() []Parser {
+	return []Parser{rule.subRule}
+}
+func (rule notRule) GetName() string {
+	return rule.name
+}
+func (rule *notRule) Rename(name string) Parser {
+	rule.name = name
+	return rule
+}
+
+// andRule succeeds, consuming nothing, where subRule succeeds
+type andRule struct {
+	subRule Parser
+	name    string
+}
+
+func (rule *andRule) Parse(input *ThreadSafeBufferedReader) error {
+	if input.state.outermost() {
+		return parseRule(rule, input)
+	}
+	start := input.Offset()
+	probe := input.Clone()
+	defer probe.Done()
+	err := parseRule(rule.subRule, probe)
+	// whether it matched or not, nothing is consumed
+	backtrack(input.state.running(rule), probe, err, start)
+	if err != nil {
+		switch err := err.(type) {
+		default:
+			return err
+		case ParseError:
+			return err.within(frameOf(rule, start))
+		}
+	}
+	return nil
+}
+func (rule andRule) GetSubRules() []Parser {
+	return []Parser{rule.subRule}
+}
+func (rule andRule) GetName() string {
+	return rule.name
+}
+func (rule *andRule) Rename(name string) Parser {
+	rule.name = name
+	return rule
+}
+
+// anyRule matches any one character, decoded as UTF-8
+type anyRule struct {
+	name string
+}
+
+func (rule anyRule) Parse(input *ThreadSafeBufferedReader) error {
+	if err := skip(input); err != nil {
+		return err
+	}
+	start := input.Offset()
+	_, _, err := input.readRune()
+	if err == io.EOF {
+		return ParseError{
+			Offset:   start,
+			Path:     []Frame{frameOf(&rule, start)},
+			Msg:      "EOF",
+			Expected: []string{"any character"},
+			Found:    "EOF",
+		}
+	}
+	return err
+}
+func (rule anyRule) GetSubRules() []Parser {
+	return []Parser{}
+}
+func (rule anyRule) GetName() string {
+	return rule.name
+}
+func (rule *anyRule) Rename(name string) Parser {
+	rule.name = name
+	return rule
+}
+
+// regexpRule matches re, which is anchored at the start, against the input
+// from the current offset
+type regexpRule struct {
+	re      *regexp.Regexp
+	pattern string
+	name    string
+}
+
+func (rule regexpRule) Parse(input *ThreadSafeBufferedReader) error {
+	if err := skip(input); err != nil {
+		return err
+	}
+	start := input.Offset()
+	// the regexp may read past the end of the match to find it
+	probe := input.Clone()
+	loc := rule.re.FindReaderIndex(probe)
+	probe.Done()
+	if loc != nil {
+		input.sbr.advance(input.id, loc[1])
+		return nil
+	}
+
+	desc := fmt.Sprintf("/%s/", rule.pattern)
+	found := "EOF"
+	peek := input.Clone()
+	if r, raw, err := peek.readRune(); err == nil {
+		found = quoteRune(r, raw)
+	}
+	peek.Done()
+	return ParseError{
+		Offset:   start,
+		Path:     []Frame{{desc, KindRegexp, start}},
+		Msg:      fmt.Sprintf("expected %s found %s", desc, found),
+		Expected: []string{desc},
+		Found:    found,
+	}
+}
+func (rule regexpRule) GetSubRules() []Parser {
+	return []Parser{}
+}
+func (rule regexpRule) GetName() string {
+	return rule.name
+}
+func (rule *regexpRule) Rename(name string) Parser {
+	rule.name = name
+	return rule
+}
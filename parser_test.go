@@ -1,6 +1,10 @@
 package gopar
 
-import "testing"
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
 
 func TestStringRule(t *testing.T) {
 	rule := &stringRule{"hello", "String"}
@@ -12,7 +16,20 @@ func TestStringRule(t *testing.T) {
 func TestStringRuleWithUnicode(t *testing.T) {
 	rule := &stringRule{"abcあいうえおdef", "String"}
 	expectNoErr(t, rule, "abcあいうえおdef")
-	expectErr(t, rule, "abcあいえおdef", "error at offset 11 in rule 'abcあいうえおdef'. expected '' found ''")
+	expectErr(t, rule, "abcあいえおdef", "error at offset 9 in rule 'abcあいうえおdef'. expected 'う' found 'え'")
+	expectErr(t, rule, "abcあい", "error at offset 9 in rule 'abcあいうえおdef'. EOF")
+	// え and う only differ in their last byte
+	expectErr(t, rule, "abcあい\xe3\x81", "error at offset 9 in rule 'abcあいうえおdef'. expected 'う' found invalid UTF-8 byte 0xe3")
+
+	emoji := &stringRule{"👍 ok", "String"}
+	expectNoErr(t, emoji, "👍 ok")
+	expectErr(t, emoji, "👎 ok", "error at offset 0 in rule '👍 ok'. expected '👍' found '👎'")
+	expectErr(t, emoji, "👍\xffok", "error at offset 4 in rule '👍 ok'. expected ' ' found invalid UTF-8 byte 0xff")
+	expectFurthestErr(t, emoji, "👍 no", "error at offset 5 (line 1, column 3) in rule '👍 ok'. expected 'o' found 'n'")
+
+	// literals don't have to be valid UTF-8 themselves
+	expectNoErr(t, &stringRule{"a\xffb", "String"}, "a\xffb")
+	expectErr(t, &stringRule{"a\xffb", "String"}, "ab", "error at offset 1 in rule 'a\xffb'. expected invalid UTF-8 byte 0xff found 'b'")
 }
 
 func TestSequenceRule(t *testing.T) {
@@ -78,3 +95,99 @@ func TestAsManyAsNumOfRule(t *testing.T) {
 	expectErr(t, rule, "abcabcabcabc!", "error at offset 9 in rule _Sequence>'!'. expected '!' found 'a'")
 }
 
+func expectValues(t *testing.T, rule Parser, inText string, expected ...interface{}) {
+	input := NewReader(strings.NewReader(inText))
+	err := rule.Parse(input)
+	if err != nil {
+		t.Error("unexpected error:", err)
+	}
+	if values := input.Stack().Values(); !reflect.DeepEqual(values, expected) {
+		t.Errorf("unexpected values: %#v", values)
+	}
+}
+
+func TestCollectorRule(t *testing.T) {
+	rule := &sequenceRule{[]Parser{
+		&collectorRule{&stringRule{"abc", "String"}, "Collect"},
+		&stringRule{"-", "String"},
+		&collectorRule{&stringRule{"あい", "String"}, "Collect"},
+	}, "_Sequence"}
+	expectNoErr(t, rule, "abc-あい")
+	expectValues(t, rule, "abc-あい", "abc", "あい")
+	expectErr(t, rule, "abd", "error at offset 2 in rule _Sequence>Collect>'abc'. expected 'c' found 'd'")
+}
+
+func TestAssembleRule(t *testing.T) {
+	digit := &collectorRule{&oneOfRule{[]Parser{
+		&stringRule{"1", ""},
+		&stringRule{"2", ""},
+	}, "OneOf"}, "Collect"}
+	rule := &assembleRule{
+		&sequenceRule{[]Parser{digit, &stringRule{"+", "String"}, digit}, "_Sequence"},
+		func(stack *Stack, mark int) error {
+			right := stack.Pop().(string)
+			left := stack.Pop().(string)
+			stack.Push(left + right)
+			return nil
+		},
+		"Assemble",
+	}
+	expectNoErr(t, rule, "1+2")
+	expectValues(t, rule, "1+2", "12")
+	expectErr(t, rule, "1-2", "error at offset 1 in rule Assemble>_Sequence>'+'. expected '+' found '-'")
+}
+
+func TestStackRollback(t *testing.T) {
+	// the first alternative collects "a" before failing; its push must not
+	// survive into the second alternative
+	rule := &sequenceRule{[]Parser{
+		&oneOfRule{[]Parser{
+			&sequenceRule{[]Parser{
+				&collectorRule{&stringRule{"a", ""}, "Collect"},
+				&stringRule{"x", ""},
+			}, "_Sequence"},
+			&collectorRule{&stringRule{"ab", ""}, "Collect"},
+		}, "OneOf"},
+		&asManyAsNumOfRule{
+			&sequenceRule{[]Parser{
+				&collectorRule{&stringRule{"c", ""}, "Collect"},
+				&stringRule{"d", ""},
+			}, "_Sequence"},
+			MaxInt,
+			"",
+		},
+	}, "_Sequence"}
+	expectValues(t, rule, "ab", "ab")
+	expectValues(t, rule, "abcdcdc", "ab", "c", "c")
+}
+
+func TestDelimitedSeqRule(t *testing.T) {
+	rule := &sequenceRule{[]Parser{
+		&stringRule{"[", ""},
+		&delimitedSeqRule{
+			&stringRule{"a", "A"},
+			&stringRule{",", ""},
+			0, MaxInt, NoTrailing, "_DelimitedSeq",
+		},
+		&stringRule{"]", ""},
+	}, "List"}
+	expectNoErr(t, rule, "[]")
+	expectNoErr(t, rule, "[a]")
+	expectNoErr(t, rule, "[a,a,a]")
+	expectErr(t, rule, "[a,]", "error at offset 2 in rule List>']'. expected ']' found ','")
+	expectErr(t, rule, "[a,a", "error at offset 4 in rule List>']'. EOF")
+}
+
+func TestSkipAndTokenRule(t *testing.T) {
+	space := &stringRule{" ", ""}
+	rule := &skipRule{space, &sequenceRule{[]Parser{
+		&stringRule{"a", ""},
+		&tokenRule{&sequenceRule{[]Parser{
+			&stringRule{"b", ""},
+			&stringRule{"c", ""},
+		}, "_Sequence"}, "BC"},
+	}, "_Sequence"}, "Skip"}
+	expectNoErr(t, rule, "abc")
+	expectNoErr(t, rule, "   a  bc ")
+	expectErr(t, rule, "  a b c", "error at offset 5 in rule Skip>_Sequence>BC>_Sequence>'c'. expected 'c' found ' '")
+}
@@ -25,6 +25,8 @@ func collectRules(
 			}
 		case *placeholderRule:
 			placeholderRules = append(placeholderRules,rule)
+		case typedRule:
+			placeholderRules = collectRules(rule.untyped(), name2Rule, placeholderRules)
 	}
 	return placeholderRules
 }
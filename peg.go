@@ -0,0 +1,277 @@
+package gopar
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+/*
+Compile reads grammars written in PEG notation:
+
+	# a comment
+	List   <- '[' Value (',' Value)* ']'
+	Value  <- List / Number
+	Number <- [0-9]+ !'.'
+
+Every definition becomes a rule built with the constructors in api.go and
+renamed after the definition. References to other rules are placeholders,
+patched once the whole grammar is read.
+
+	A / B      OneOf
+	A B        Seq
+	A* A+ A?   ZeroOrMoreOf, OneOrMoreOf, ZeroOrOneOf
+	!A &A      Not, And
+	'a' "a"    S, with \n \r \t \\ \' \" \[ \] \- escapes
+	[a-z_]     a character class, [^...] for the complement
+	.          AnyChar
+	(A)        grouping
+*/
+
+type pegDefinition struct {
+	name   string
+	offset int
+	rule   Parser
+}
+
+// Compile turns grammar into rules, one for every definition. Syntax errors
+// are ParseErrors carrying the line and column they happened at.
+func Compile(grammar string) (map[string]Parser, error) {
+	// where every reference was made, for reporting the undefined ones
+	refs := map[Parser]int{}
+	input := NewReader(strings.NewReader(grammar))
+	defer input.Done()
+	if err := parseRule(pegGrammar(refs), input); err != nil {
+		return nil, input.state.report(err, input)
+	}
+
+	located := func(err ParseError) error {
+		// a reader of its own, the one the grammar was parsed with may have
+		// let go of the line err is on
+		at := NewReader(strings.NewReader(grammar))
+		defer at.Done()
+		return locate(err, at)
+	}
+	rules := map[string]Parser{}
+	definedAt := map[string]int{}
+	var all []Parser
+	for _, value := range input.Stack().Values() {
+		def := value.(pegDefinition)
+		if offset, ok := definedAt[def.name]; ok {
+			line := strings.Count(grammar[:offset], "\n") + 1
+			return nil, located(ParseError{
+				Offset: def.offset,
+				Path:   []Frame{{def.name, KindOther, def.offset}},
+				Msg:    fmt.Sprintf("rule '%s' is already defined on line %d", def.name, line),
+			})
+		}
+		definedAt[def.name] = def.offset
+		rules[def.name] = def.rule
+		all = append(all, def.rule)
+	}
+
+	for _, rule := range all {
+		placeholders := collectRules(rule, map[string]Parser{}, nil)
+		// report the first undefined reference in the grammar
+		sort.Slice(placeholders, func(i, j int) bool { return refs[placeholders[i]] < refs[placeholders[j]] })
+		for _, placeholder := range placeholders {
+			if _, ok := rules[placeholder.GetName()]; !ok {
+				offset := refs[placeholder]
+				return nil, located(ParseError{
+					Offset: offset,
+					Path:   []Frame{{rule.GetName(), KindOther, definedAt[rule.GetName()]}, frameOf(placeholder, offset)},
+					Msg:    fmt.Sprintf("undefined rule '%s'", placeholder.GetName()),
+				})
+			}
+		}
+	}
+	if err := Patch(all...); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// pegGrammar is the grammar of the grammars Compile reads. It leaves a
+// pegDefinition on the stack for every definition and records where each
+// reference was made in refs.
+func pegGrammar(refs map[Parser]int) Parser {
+	spacing := OneOf(
+		OneOrMoreOf(OneOfChars(" \t\r\n")),
+		Seq(S("#"), ZeroOrMoreOf(NoneOf("\n"))),
+	)
+
+	// pushes the offset and the name
+	identifier := Token(Seq(
+		&offsetRule{"_Offset"},
+		Collect(Seq(
+			OneOf(CharRange('a', 'z'), CharRange('A', 'Z'), OneOfChars("_")),
+			ZeroOrMoreOf(OneOf(CharRange('a', 'z'), CharRange('A', 'Z'), CharRange('0', '9'), OneOfChars("_"))),
+		)),
+	)).Rename("Identifier")
+
+	escapes := map[string]rune{"n": '\n', "r": '\r', "t": '\t'}
+	char := OneOf(
+		pegBuild(Seq(S(`\`), Collect(OneOfChars(`nrt\'"[]-`))), func(values []interface{}) interface{} {
+			escaped := values[0].(string)
+			if r, ok := escapes[escaped]; ok {
+				return r
+			}
+			return []rune(escaped)[0]
+		}),
+		pegBuild(Collect(NoneOf(`\`)), func(values []interface{}) interface{} {
+			return []rune(values[0].(string))[0]
+		}),
+	).Rename("Char")
+
+	literalText := func(values []interface{}) interface{} {
+		runes := make([]rune, len(values))
+		for i, value := range values {
+			runes[i] = value.(rune)
+		}
+		return S(string(runes))
+	}
+	literal := Token(OneOf(
+		pegBuild(Seq(S("'"), ZeroOrMoreOf(Seq(Not(S("'")), char)), S("'")), literalText),
+		pegBuild(Seq(S(`"`), ZeroOrMoreOf(Seq(Not(S(`"`)), char)), S(`"`)), literalText),
+	)).Rename("Literal")
+
+	classChar := Seq(Not(S("]")), char)
+	charRange := OneOf(
+		pegBuild(Seq(classChar, S("-"), classChar), func(values []interface{}) interface{} {
+			return runeRange{values[0].(rune), values[1].(rune)}
+		}),
+		pegBuild(classChar, func(values []interface{}) interface{} {
+			return runeRange{values[0].(rune), values[0].(rune)}
+		}),
+	)
+	class := Token(pegBuild(
+		Seq(S("["), Collect(ZeroOrOneOf(S("^"))), OneOrMoreOf(charRange), S("]")),
+		func(values []interface{}) interface{} {
+			negate := values[0].(string) == "^"
+			var ranges []runeRange
+			for _, value := range values[1:] {
+				ranges = append(ranges, value.(runeRange))
+			}
+			ranges = mergeRanges(ranges)
+			return newCharClass(ranges, nil, negate, describeRanges(ranges, negate), "_CharClass")
+		},
+	)).Rename("Class")
+
+	primary := OneOf(
+		pegBuild(Seq(identifier, Not(S("<-"))), func(values []interface{}) interface{} {
+			ref := P(values[1].(string))
+			refs[ref] = values[0].(int)
+			return ref
+		}),
+		Seq(S("("), P("Expression"), S(")")),
+		literal,
+		class,
+		pegBuild(S("."), func(values []interface{}) interface{} {
+			return AnyChar()
+		}),
+	).Rename("Primary")
+
+	suffix := pegBuild(
+		Seq(primary, Token(Collect(ZeroOrOneOf(OneOfChars("*+?"))))),
+		func(values []interface{}) interface{} {
+			rule := values[0].(Parser)
+			switch values[1].(string) {
+			case "*":
+				return ZeroOrMoreOf(rule)
+			case "+":
+				return OneOrMoreOf(rule)
+			case "?":
+				return ZeroOrOneOf(rule)
+			}
+			return rule
+		},
+	).Rename("Suffix")
+
+	prefix := pegBuild(
+		Seq(Token(Collect(ZeroOrOneOf(OneOfChars("&!")))), suffix),
+		func(values []interface{}) interface{} {
+			rule := values[1].(Parser)
+			switch values[0].(string) {
+			case "&":
+				return And(rule)
+			case "!":
+				return Not(rule)
+			}
+			return rule
+		},
+	).Rename("Prefix")
+
+	sequence := pegBuild(OneOrMoreOf(prefix), func(values []interface{}) interface{} {
+		if len(values) == 1 {
+			return values[0]
+		}
+		return Seq(pegRules(values)...)
+	}).Rename("Sequence")
+
+	expression := pegBuild(DelimitedSeqOf(sequence, S("/"), 1, MaxInt, NoTrailing), func(values []interface{}) interface{} {
+		if len(values) == 1 {
+			return values[0]
+		}
+		return OneOf(pegRules(values)...)
+	}).Rename("Expression")
+
+	definition := pegBuild(Seq(identifier, S("<-"), expression), func(values []interface{}) interface{} {
+		name := values[1].(string)
+		rule := values[2].(Parser)
+		// a placeholder can't be renamed
+		if _, ok := rule.(*placeholderRule); ok {
+			rule = Seq(rule)
+		}
+		return pegDefinition{name, values[0].(int), rule.Rename(name)}
+	}).Rename("Definition")
+
+	grammar := Skip(spacing, Seq(OneOrMoreOf(definition), EOF())).Rename("Grammar")
+	if err := Patch(grammar); err != nil {
+		panic(err)
+	}
+	return grammar
+}
+
+// pegBuild replaces whatever parser pushed with what build makes of it
+func pegBuild(parser Parser, build func(values []interface{}) interface{}) Parser {
+	return &assembleRule{
+		parser,
+		func(stack *Stack, mark int) error {
+			values := make([]interface{}, stack.Len()-mark)
+			for i := len(values) - 1; i >= 0; i-- {
+				values[i] = stack.Pop()
+			}
+			stack.Push(build(values))
+			return nil
+		},
+		"_Assemble",
+	}
+}
+
+func pegRules(values []interface{}) []Parser {
+	rules := make([]Parser, len(values))
+	for i, value := range values {
+		rules[i] = value.(Parser)
+	}
+	return rules
+}
+
+// offsetRule matches nothing and pushes the offset it's at
+type offsetRule struct {
+	name string
+}
+
+func (rule offsetRule) Parse(input *ThreadSafeBufferedReader) error {
+	input.stack.Push(input.Offset())
+	return nil
+}
+func (rule offsetRule) GetSubRules() []Parser {
+	return []Parser{}
+}
+func (rule offsetRule) GetName() string {
+	return rule.name
+}
+func (rule *offsetRule) Rename(name string) Parser {
+	rule.name = name
+	return rule
+}
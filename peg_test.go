@@ -0,0 +1,104 @@
+package gopar
+
+import (
+	"strings"
+	"testing"
+)
+
+const pegJson = `
+# the JSON grammar from json_test.go
+Value     <- JsonString / Number / Object / List
+Object    <- '{' (KeyValue (',' KeyValue)*)? '}'
+KeyValue  <- JsonString ':' Value
+List      <- "[" (Value ("," Value)*)? "]"
+JsonString <- '"' [^"\\]+ '"'
+Number    <- Digit+ ('.' Digit+)?
+Digit     <- [0-9]
+`
+
+func compile(t *testing.T, grammar string) map[string]Parser {
+	rules, err := Compile(grammar)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rules
+}
+
+func TestCompile(t *testing.T) {
+	rules := compile(t, pegJson)
+	value := rules["Value"]
+	expectNoErr(t, value, `{"a":[1,2.5,{"b":"c d"}],"e":{}}`)
+	expectNoErr(t, rules["Number"], "12.5")
+	err := ParseAll(value, strings.NewReader(`{"a":[1,}`))
+	if err == nil || err.Error() != "error at offset 8 (line 1, column 9) in rule Value>Object>_ZeroOrOneOf>_Sequence>KeyValue>Value>List>_ZeroOrOneOf>_Sequence>_ZeroOrMoreOf>_Sequence>Value. expected Value found '}'" {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if rules["Digit"].GetName() != "Digit" || kindOf(rules["Object"]) != KindSequence {
+		t.Error("unexpected rules")
+	}
+}
+
+func TestCompileOperators(t *testing.T) {
+	rules := compile(t, `
+		Ident   <- !Keyword [a-zA-Z_] [a-zA-Z0-9_]*
+		Keyword <- ('if' / 'else') ![a-z]
+		Peek    <- &'a' .
+		Escaped <- '\'\n' "\"" [\]\-]
+		Alias   <- Ident
+	`)
+	expectNoErr(t, rules["Ident"], "iffy")
+	expectNoErr(t, rules["Ident"], "_x1")
+	expectErr(t, rules["Ident"], "if", "error at offset 0 in rule Ident>_Not. unexpected 'i'")
+	expectNoErr(t, rules["Peek"], "a")
+	expectErr(t, rules["Peek"], "b", "error at offset 0 in rule Peek>_And>'a'. expected 'a' found 'b'")
+	expectNoErr(t, rules["Escaped"], "'\n\"]")
+	expectNoErr(t, rules["Escaped"], "'\n\"-")
+	expectNoErr(t, rules["Alias"], "abc")
+	if rules["Alias"].GetName() != "Alias" {
+		t.Errorf("unexpected name: %s", rules["Alias"].GetName())
+	}
+}
+
+func TestCompileOperatorsAfterComments(t *testing.T) {
+	rules := compile(t, "Ident <- # not a keyword\n  !'if' [a-z]+\nA <- 'a' # many\n  *\n")
+	expectErr(t, rules["Ident"], "if", "error at offset 0 in rule Ident>_Not. unexpected 'i'")
+	if err := ParseAll(rules["A"], strings.NewReader("aaa")); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestCompileLeftRecursion(t *testing.T) {
+	rules := compile(t, `
+		Sum <- Sum '+' Num / Num
+		Num <- [0-9]+
+	`)
+	tree, err := ParseTree(rules["Sum"], strings.NewReader("1+2+3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree.String() != `Sum(Sum(Sum(Num("1")) Num("2")) Num("3"))` {
+		t.Errorf("unexpected tree: %s", tree)
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for grammar, expected := range map[string]string{
+		"A <- 'a'\nB <- 'b' /\n":        "error at offset 20 (line 3, column 1) in rule Grammar>_Sequence>OneOrMoreOf>>Definition>_Sequence>Expression>_DelimitedSeq>Sequence. expected Sequence found EOF",
+		"A <- 'a\n":                     "error at offset 8 (line 2, column 1) in rule Grammar>_Sequence>OneOrMoreOf>>Definition>_Sequence>Expression>_DelimitedSeq>Sequence>OneOrMoreOf>>Prefix>_Sequence>Suffix>_Sequence>Primary>Literal>_OneOf>_Assemble>_Sequence>_ZeroOrMoreOf>_Sequence>Char. expected one of Char, ''' found EOF",
+		"A <- 'a'\n  B = 'b'":           "error at offset 13 (line 2, column 5) in rule Grammar>_Sequence>OneOrMoreOf>>Definition>_Sequence>Expression>_DelimitedSeq>Sequence>OneOrMoreOf>>Prefix>_Sequence>Suffix>_Sequence>_Token>_Collect>_ZeroOrOneOf>[*+?]. expected one of [*+?], Prefix, '/', Definition, EOF found '='",
+		"A <- [a-\n":                    "error at offset 9 (line 2, column 1) in rule Grammar>_Sequence>OneOrMoreOf>>Definition>_Sequence>Expression>_DelimitedSeq>Sequence>OneOrMoreOf>>Prefix>_Sequence>Suffix>_Sequence>Primary>Class>_Assemble>_Sequence>OneOrMoreOf>>_OneOf>_Assemble>_Sequence>_Sequence>Char. expected one of Char, ']' found EOF",
+		"A <- B\n":                      "error at offset 5 (line 1, column 6) in rule A>B. undefined rule 'B'",
+		"A <- 'a'\n# again\nA <- 'b'\n": "error at offset 17 (line 3, column 1) in rule A. rule 'A' is already defined on line 1",
+		"":                              "error at offset 0 (line 1, column 1) in rule Grammar. expected Grammar found EOF",
+	} {
+		_, err := Compile(grammar)
+		if err == nil {
+			t.Errorf("%q: expected an error", grammar)
+		} else if err.Error() != expected {
+			t.Errorf("%q: unexpected error: %v", grammar, err)
+		}
+		if _, ok := err.(ParseError); !ok {
+			t.Errorf("%q: expected a ParseError, got %T", grammar, err)
+		}
+	}
+}
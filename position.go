@@ -0,0 +1,180 @@
+package gopar
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// bytes every reader is done with that the sharedBufferedReader holds on
+	// to anyway so error messages can quote the line they happened in
+	retainedContext = 512
+	// how far an error message quotes past the error offset
+	lineLookahead = 256
+)
+
+type lineStart struct {
+	offset int
+	runes  int
+}
+
+// lineTracker keeps the start of every line as input flows through a
+// sharedBufferedReader, counting both bytes and runes. Lines that are
+// entirely before the buffer are dropped along with the buffer.
+type lineTracker struct {
+	starts       []lineStart
+	dropped      int
+	fetched      int
+	runes        int
+	droppedRunes int
+}
+
+func newLineTracker() lineTracker {
+	return lineTracker{starts: []lineStart{{0, 0}}}
+}
+
+// track is handed every byte fetched from the wrapped reader in order
+func (lt *lineTracker) track(b []byte) {
+	for _, c := range b {
+		lt.fetched++
+		if utf8.RuneStart(c) {
+			lt.runes++
+		}
+		if c == '\n' {
+			lt.starts = append(lt.starts, lineStart{lt.fetched, lt.runes})
+		}
+	}
+}
+
+// drop is handed the bytes dropped from the front of the buffer, which now
+// starts at bufferStart
+func (lt *lineTracker) drop(b []byte, bufferStart int) {
+	lt.droppedRunes += countRuneStarts(b)
+	for len(lt.starts) > 1 && lt.starts[1].offset <= bufferStart {
+		lt.starts = lt.starts[1:]
+		lt.dropped++
+	}
+}
+
+// unlike utf8.RuneCount this gives the same total when b is split mid-rune
+func countRuneStarts(b []byte) int {
+	n := 0
+	for _, c := range b {
+		if utf8.RuneStart(c) {
+			n++
+		}
+	}
+	return n
+}
+
+// position returns the 1-based line, byte column and rune column of offset.
+// Whatever is no longer known because it was dropped is 0.
+func (sbr *sharedBufferedReader) position(offset int) (line, column, runeColumn int) {
+	sbr.mutex.Lock()
+	defer sbr.mutex.Unlock()
+	lt := &sbr.lines
+	i := sort.Search(len(lt.starts), func(i int) bool { return lt.starts[i].offset > offset }) - 1
+	if i < 0 || offset > lt.fetched {
+		return 0, 0, 0
+	}
+	line = lt.dropped + i + 1
+	column = offset - lt.starts[i].offset + 1
+	if offset >= sbr.bytesRead {
+		runes := lt.droppedRunes + countRuneStarts(sbr.buffer[:offset-sbr.bytesRead])
+		runeColumn = runes - lt.starts[i].runes + 1
+	}
+	return line, column, runeColumn
+}
+
+// sourceLine returns as much of the line containing offset as is buffered
+// and the column its first byte is at.
+func (sbr *sharedBufferedReader) sourceLine(offset int) (string, int) {
+	sbr.mutex.Lock()
+	defer sbr.mutex.Unlock()
+	lt := &sbr.lines
+	i := sort.Search(len(lt.starts), func(i int) bool { return lt.starts[i].offset > offset }) - 1
+	if i < 0 || offset < sbr.bytesRead || offset > lt.fetched {
+		return "", 0
+	}
+	from := lt.starts[i].offset
+	if from < sbr.bytesRead {
+		from = sbr.bytesRead
+	}
+	text := sbr.buffer[from-sbr.bytesRead:]
+	// what was read ahead may go on well past the error
+	text = text[:min(len(text), offset-from+lineLookahead)]
+	if end := bytes.IndexByte(text[offset-from:], '\n'); end >= 0 {
+		text = text[:offset-from+end]
+	}
+	return strings.TrimSuffix(string(text), "\r"), from - lt.starts[i].offset + 1
+}
+
+// locate fills in where err happened. input has to be the reader the parse
+// started with.
+func locate(err ParseError, input *ThreadSafeBufferedReader) ParseError {
+	// make sure the rest of the line is buffered before quoting it
+	peek := input.Clone()
+	defer peek.Done()
+	b := make([]byte, 1)
+	for peek.Offset() < err.Offset+lineLookahead {
+		if n, readErr := peek.Read(b); n == 0 || readErr != nil {
+			break
+		}
+		if peek.Offset() > err.Offset && b[0] == '\n' {
+			break
+		}
+	}
+	err.Line, err.Column, err.RuneColumn = input.sbr.position(err.Offset)
+	err.SourceLine, err.sourceColumn = input.sbr.sourceLine(err.Offset)
+	return err
+}
+
+const (
+	ansiReset = "\x1b[0m"
+	ansiBold  = "\x1b[1m"
+	ansiRed   = "\x1b[1;31m"
+	ansiFaint = "\x1b[2m"
+)
+
+// Snippet renders the error followed by the line it happened in and a caret
+// under the column, optionally colored for a terminal.
+func (p ParseError) Snippet(color bool) string {
+	paint := func(code, s string) string {
+		if !color {
+			return s
+		}
+		return code + s + ansiReset
+	}
+	var out strings.Builder
+	out.WriteString(paint(ansiBold, p.Error()))
+	if p.sourceColumn == 0 {
+		return out.String()
+	}
+
+	gutter := fmt.Sprintf("%d", p.Line)
+	source := p.SourceLine
+	caretAt := p.Column - p.sourceColumn
+	if p.sourceColumn > 1 {
+		source = "..." + source
+		caretAt += len("...")
+	}
+	if caretAt > len(source) {
+		caretAt = len(source)
+	}
+	// keep tabs so the caret lines up however wide the terminal draws them
+	var padding strings.Builder
+	for _, r := range source[:caretAt] {
+		if r == '\t' {
+			padding.WriteRune('\t')
+		} else {
+			padding.WriteRune(' ')
+		}
+	}
+	fmt.Fprintf(&out, "\n%s %s\n%s %s%s",
+		paint(ansiFaint, gutter+" |"), source,
+		paint(ansiFaint, strings.Repeat(" ", len(gutter))+" |"), padding.String(), paint(ansiRed, "^"))
+	return out.String()
+}
@@ -0,0 +1,87 @@
+package gopar
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPosition(t *testing.T) {
+	input := NewReader(strings.NewReader("ab\nあいc\n\nd"))
+	b := make([]byte, 13)
+	if _, err := input.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct{ offset, line, column, runeColumn int }{
+		{0, 1, 1, 1},
+		{2, 1, 3, 3},
+		{3, 2, 1, 1},
+		{6, 2, 4, 2},
+		{9, 2, 7, 3},
+		{11, 3, 1, 1},
+		{12, 4, 1, 1},
+		{13, 4, 2, 2},
+	} {
+		line, column, runeColumn := input.sbr.position(c.offset)
+		if line != c.line || column != c.column || runeColumn != c.runeColumn {
+			t.Errorf("offset %d: unexpected position %d:%d:%d", c.offset, line, column, runeColumn)
+		}
+	}
+}
+
+func TestPositionAfterDroppingBuffer(t *testing.T) {
+	text := strings.Repeat("あ\n", 1000) + "xyz"
+	input := NewReader(strings.NewReader(text))
+	b := make([]byte, 4002)
+	if _, err := input.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	if len(input.sbr.buffer) > retainedContext {
+		t.Errorf("buffer wasn't dropped: %d", len(input.sbr.buffer))
+	}
+	line, column, runeColumn := input.sbr.position(4001)
+	if line != 1001 || column != 2 || runeColumn != 2 {
+		t.Errorf("unexpected position %d:%d:%d", line, column, runeColumn)
+	}
+	if line, _, _ := input.sbr.position(10); line != 0 {
+		t.Errorf("dropped line shouldn't be known: %d", line)
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	rule := Seq(S("a\n"), S("\tbcd"), S("\n"))
+	err := Parse(rule, strings.NewReader("a\n\tbxd\ne"))
+	parseErr, ok := err.(ParseError)
+	if !ok {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if parseErr.Line != 2 || parseErr.Column != 3 || parseErr.SourceLine != "\tbxd" {
+		t.Errorf("unexpected location: %#v", parseErr)
+	}
+	expected := "error at offset 4 (line 2, column 3) in rule _Sequence>'\tbcd'. expected 'c' found 'x'\n" +
+		"2 | \tbxd\n" +
+		"  | \t ^"
+	if parseErr.Snippet(false) != expected {
+		t.Errorf("unexpected snippet:\n%s", parseErr.Snippet(false))
+	}
+	colored := parseErr.Snippet(true)
+	if !strings.Contains(colored, ansiRed+"^"+ansiReset) || !strings.HasPrefix(colored, ansiBold) {
+		t.Errorf("unexpected colored snippet: %q", colored)
+	}
+}
+
+func TestSnippetOfLongLine(t *testing.T) {
+	rule := Seq(OneOrMoreOf(S("a")), S("!"))
+	err := Parse(rule, strings.NewReader(strings.Repeat("a", 2000)+"?"+strings.Repeat("b", 1000)))
+	snippet := err.(ParseError).Snippet(false)
+	lines := strings.Split(snippet, "\n")
+	if len(lines) != 3 {
+		t.Fatalf("unexpected snippet: %q", snippet)
+	}
+	source := strings.TrimPrefix(lines[1], "1 | ")
+	if !strings.HasPrefix(source, "...aaa") || !strings.HasSuffix(source, "?"+strings.Repeat("b", lineLookahead-1)) {
+		t.Errorf("unexpected source line: %q", source)
+	}
+	if strings.Index(lines[2], "^") != strings.Index(lines[1], "?") {
+		t.Errorf("caret isn't under the error:\n%s", snippet)
+	}
+}
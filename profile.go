@@ -0,0 +1,352 @@
+package gopar
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+/*
+A Profiler is a Tracer that adds up what every named rule cost. Unnamed rules
+count toward the named rule they're part of, so the time a OneOf spends on
+alternatives that don't pan out, and the input it has to read again after
+throwing them away, shows up under the rule the OneOf was named after.
+
+Time is measured between Enter and Exit. A rule's time includes the rules it
+runs, its self time doesn't include the named ones; a rule that recurses into
+itself is only timed once.
+
+Reread is how far a rule backtracked, added up. It's the input the rule
+threw away and whatever runs next may read again, not what actually gets read
+again: the next alternative may give up before it gets that far. And and Not
+count too, since they go back over everything they looked at every time, so
+a grammar full of lookahead rereads a lot without doing anything wrong.
+*/
+
+// RuleStats is what a Profiler found out about a named rule.
+type RuleStats struct {
+	Name     string
+	Calls    int
+	Matches  int
+	Failures int
+	// how often the rule threw away what it had parsed and how many bytes
+	// that was, see Reread above
+	Backtracks int
+	Reread     int
+	Time       time.Duration
+	SelfTime   time.Duration
+}
+
+// ProfileOrder is what WriteTable sorts rules by.
+type ProfileOrder int
+
+const (
+	ByTime ProfileOrder = iota
+	BySelfTime
+	ByCalls
+	ByFailures
+	ByReread
+	ByName
+)
+
+type profileFrame struct {
+	// whether the frame is a rule the profile has a row for
+	named bool
+	start time.Time
+	// time spent in named rules run by this one
+	inner time.Duration
+	// the named rules this one is nested in, outermost first, itself included
+	stack []string
+}
+
+// profileSample is what was spent in the innermost rule of stack
+type profileSample struct {
+	stack                            []string
+	calls, nanos, backtracks, reread int64
+}
+
+// Profiler is a Tracer that profiles the named rules of a parse. Hand it to
+// ParseTraced and have a look with Stats, WriteTable or WritePprof once the
+// parse is done.
+type Profiler struct {
+	stats   map[string]*RuleStats
+	names   []string
+	samples map[string]*profileSample
+	keys    []string
+	frames  []profileFrame
+	// how many times each rule is running right now
+	running map[string]int
+	started time.Time
+	now     func() time.Time
+}
+
+func NewProfiler() *Profiler {
+	return &Profiler{
+		stats:   map[string]*RuleStats{},
+		samples: map[string]*profileSample{},
+		running: map[string]int{},
+		now:     time.Now,
+	}
+}
+
+func (p *Profiler) ruleStats(name string) *RuleStats {
+	stats, ok := p.stats[name]
+	if !ok {
+		stats = &RuleStats{Name: name}
+		p.stats[name] = stats
+		p.names = append(p.names, name)
+	}
+	return stats
+}
+
+func (p *Profiler) sample(stack []string) *profileSample {
+	key := strings.Join(stack, "\x00")
+	sample, ok := p.samples[key]
+	if !ok {
+		sample = &profileSample{stack: stack}
+		p.samples[key] = sample
+		p.keys = append(p.keys, key)
+	}
+	return sample
+}
+
+// innermost returns the innermost frame that's a named rule, if any
+func (p *Profiler) innermost() *profileFrame {
+	for i := len(p.frames) - 1; i >= 0; i-- {
+		if p.frames[i].named {
+			return &p.frames[i]
+		}
+	}
+	return nil
+}
+
+func (p *Profiler) Enter(rule Parser, offset int) {
+	now := p.now()
+	if p.started.IsZero() {
+		p.started = now
+	}
+	outer := p.innermost()
+	// rules outside any named rule get a row of their own
+	if !isProduction(rule) && outer != nil {
+		p.frames = append(p.frames, profileFrame{})
+		return
+	}
+	name := traceLabel(rule)
+	var stack []string
+	if outer != nil {
+		stack = append(stack, outer.stack...)
+	}
+	stack = append(stack[:len(stack):len(stack)], name)
+	p.frames = append(p.frames, profileFrame{named: true, start: now, stack: stack})
+	p.running[name]++
+	p.ruleStats(name).Calls++
+}
+
+func (p *Profiler) Exit(rule Parser, offset int, err error) {
+	frame := p.frames[len(p.frames)-1]
+	p.frames = p.frames[:len(p.frames)-1]
+	if !frame.named {
+		return
+	}
+	elapsed := p.now().Sub(frame.start)
+	name := frame.stack[len(frame.stack)-1]
+	stats := p.stats[name]
+	if err != nil {
+		stats.Failures++
+	} else {
+		stats.Matches++
+	}
+	self := elapsed - frame.inner
+	stats.SelfTime += self
+	p.running[name]--
+	if p.running[name] == 0 {
+		stats.Time += elapsed
+	}
+	if outer := p.innermost(); outer != nil {
+		outer.inner += elapsed
+	}
+	sample := p.sample(frame.stack)
+	sample.calls++
+	sample.nanos += int64(self)
+}
+
+func (p *Profiler) Backtrack(rule Parser, from, to int) {
+	stack := []string{traceLabel(rule)}
+	if frame := p.innermost(); frame != nil {
+		stack = frame.stack
+	}
+	stats := p.ruleStats(stack[len(stack)-1])
+	stats.Backtracks++
+	stats.Reread += from - to
+	sample := p.sample(stack)
+	sample.backtracks++
+	sample.reread += int64(from - to)
+}
+
+// Stats returns what was found out about every named rule, in the order they
+// were first run.
+func (p *Profiler) Stats() []RuleStats {
+	stats := make([]RuleStats, len(p.names))
+	for i, name := range p.names {
+		stats[i] = *p.stats[name]
+	}
+	return stats
+}
+
+// WriteTable writes Stats to w as a table, with the rules sorted by order,
+// most first:
+//
+//	rule        calls  matches  failures  backtracks  reread     time     self
+//	Value         412      208       204         204    1630  812.4µs  301.2µs
+func (p *Profiler) WriteTable(w io.Writer, order ProfileOrder) error {
+	stats := p.Stats()
+	key := func(s RuleStats) int64 {
+		switch order {
+		case BySelfTime:
+			return int64(s.SelfTime)
+		case ByCalls:
+			return int64(s.Calls)
+		case ByFailures:
+			return int64(s.Failures)
+		case ByReread:
+			return int64(s.Reread)
+		}
+		return int64(s.Time)
+	}
+	sort.SliceStable(stats, func(i, j int) bool {
+		if order == ByName {
+			return stats[i].Name < stats[j].Name
+		}
+		return key(stats[i]) > key(stats[j])
+	})
+
+	rows := [][]string{{"rule", "calls", "matches", "failures", "backtracks", "reread", "time", "self"}}
+	for _, s := range stats {
+		rows = append(rows, []string{s.Name, fmt.Sprint(s.Calls), fmt.Sprint(s.Matches), fmt.Sprint(s.Failures),
+			fmt.Sprint(s.Backtracks), fmt.Sprint(s.Reread), s.Time.String(), s.SelfTime.String()})
+	}
+	widths := make([]int, len(rows[0]))
+	for _, row := range rows {
+		for i, cell := range row {
+			widths[i] = max(widths[i], utf8.RuneCountInString(cell))
+		}
+	}
+	// the names line up on the left, the numbers on the right
+	var out strings.Builder
+	for _, row := range rows {
+		fmt.Fprintf(&out, "%-*s", widths[0], row[0])
+		for i := 1; i < len(row); i++ {
+			fmt.Fprintf(&out, "  %*s", widths[i], row[i])
+		}
+		out.WriteString("\n")
+	}
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+// WritePprof writes the profile to w in the format go tool pprof reads, with
+// calls, time, backtracks and bytes re-read as sample types:
+//
+//	go tool pprof -sample_index=reread -top parse.pprof
+func (p *Profiler) WritePprof(w io.Writer) error {
+	var strs []string
+	index := map[string]int{}
+	str := func(s string) uint64 {
+		i, ok := index[s]
+		if !ok {
+			i = len(strs)
+			index[s] = i
+			strs = append(strs, s)
+		}
+		return uint64(i)
+	}
+	str("")
+
+	var profile protoBuf
+	for _, sampleType := range [][2]string{{"calls", "count"}, {"time", "nanoseconds"}, {"backtracks", "count"}, {"reread", "bytes"}} {
+		var valueType protoBuf
+		valueType.uint(1, str(sampleType[0]))
+		valueType.uint(2, str(sampleType[1]))
+		profile.message(1, valueType)
+	}
+	// a function and a location, with the same id, for every rule
+	ids := map[string]uint64{}
+	for _, name := range p.names {
+		ids[name] = uint64(len(ids) + 1)
+	}
+	for _, key := range p.keys {
+		sample := p.samples[key]
+		var locations []uint64
+		for i := len(sample.stack) - 1; i >= 0; i-- {
+			locations = append(locations, ids[sample.stack[i]])
+		}
+		var s protoBuf
+		s.packed(1, locations)
+		s.packed(2, []uint64{uint64(sample.calls), uint64(sample.nanos), uint64(sample.backtracks), uint64(sample.reread)})
+		profile.message(2, s)
+	}
+	for _, name := range p.names {
+		var line, location, function protoBuf
+		line.uint(1, ids[name])
+		location.uint(1, ids[name])
+		location.message(4, line)
+		profile.message(4, location)
+		function.uint(1, ids[name])
+		function.uint(2, str(name))
+		function.uint(3, str(name))
+		profile.message(5, function)
+	}
+	if !p.started.IsZero() {
+		profile.uint(9, uint64(p.started.UnixNano()))
+	}
+	defaultType := str("time")
+	for _, s := range strs {
+		profile.bytes(6, []byte(s))
+	}
+	profile.uint(14, defaultType)
+
+	zipped := gzip.NewWriter(w)
+	if _, err := zipped.Write(profile); err != nil {
+		return err
+	}
+	return zipped.Close()
+}
+
+// protoBuf is a protocol buffer message being encoded, just enough of the
+// encoding for profile.proto
+type protoBuf []byte
+
+func (b *protoBuf) varint(v uint64) {
+	for v >= 0x80 {
+		*b = append(*b, byte(v)|0x80)
+		v >>= 7
+	}
+	*b = append(*b, byte(v))
+}
+
+func (b *protoBuf) uint(field int, v uint64) {
+	b.varint(uint64(field) << 3)
+	b.varint(v)
+}
+
+func (b *protoBuf) bytes(field int, v []byte) {
+	b.varint(uint64(field)<<3 | 2)
+	b.varint(uint64(len(v)))
+	*b = append(*b, v...)
+}
+
+func (b *protoBuf) message(field int, m protoBuf) {
+	b.bytes(field, m)
+}
+
+func (b *protoBuf) packed(field int, vs []uint64) {
+	var packed protoBuf
+	for _, v := range vs {
+		packed.varint(v)
+	}
+	b.bytes(field, packed)
+}
@@ -0,0 +1,98 @@
+package gopar
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// profiledStatement parses "f(a,);" with a clock that moves on a
+// millisecond every time it's read
+func profiledStatement() *Profiler {
+	word := OneOrMoreOf(CharRange('a', 'z')).Rename("Word")
+	call := Seq(word, S("("), DelimitedSeq(word, S(",")), S(")")).Rename("Call")
+	statement := OneOf(call, Seq(word, S(";"))).Rename("Statement")
+
+	profiler := NewProfiler()
+	clock := time.Unix(0, 0)
+	profiler.now = func() time.Time {
+		clock = clock.Add(time.Millisecond)
+		return clock
+	}
+	ParseTraced(statement, strings.NewReader("f(a,);"), profiler)
+	return profiler
+}
+
+func TestProfiler(t *testing.T) {
+	var out bytes.Buffer
+	if err := profiledStatement().WriteTable(&out, ByReread); err != nil {
+		t.Fatal(err)
+	}
+	expected := `rule       calls  matches  failures  backtracks  reread  time  self
+Statement      1        0         1           2       4  31ms   5ms
+Call           1        0         1           1       1  21ms   8ms
+Word           4        3         1           0       0  18ms  18ms
+`
+	if out.String() != expected {
+		t.Errorf("unexpected table:\n%s", out.String())
+	}
+}
+
+func TestProfilerRecursion(t *testing.T) {
+	list := P("List")
+	Patch(OneOf(Seq(S("("), ZeroOrMoreOf(list), S(")")), S("x")).Rename("List"), list)
+
+	profiler := NewProfiler()
+	clock := time.Unix(0, 0)
+	profiler.now = func() time.Time {
+		clock = clock.Add(time.Millisecond)
+		return clock
+	}
+	if err := ParseTraced(list, strings.NewReader("((x))"), profiler); err != nil {
+		t.Fatal(err)
+	}
+	stats := profiler.Stats()
+	if len(stats) != 1 || stats[0].Name != "List" {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	// time is counted once for the outermost List, self time for all of them
+	if stats[0].Time != stats[0].SelfTime {
+		t.Errorf("time %s should be self time %s", stats[0].Time, stats[0].SelfTime)
+	}
+}
+
+func TestWritePprof(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs go tool pprof")
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("no go tool")
+	}
+	path := filepath.Join(t.TempDir(), "parse.pprof")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := profiledStatement().WritePprof(file); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	out, err := exec.Command(goTool, "tool", "pprof", "-sample_index=reread", "-top", path).CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	for _, line := range []string{
+		"4B 80.00% 80.00%         5B   100%  Statement",
+		"1B 20.00%   100%         1B 20.00%  Call",
+	} {
+		if !strings.Contains(string(out), line) {
+			t.Errorf("expected %q in\n%s", line, out)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package gopar
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+/*
+Railroad diagrams are laid out bottom up: every item knows how wide it is and
+how far it reaches above and below the line running through it, and is drawn
+with that line entering on the left and leaving on the right. Alternatives
+hang below the first one, optional items are skipped over from above and
+repeats loop back underneath, with the separator on the way back.
+*/
+
+const (
+	railArc       = 10
+	railGap       = 10
+	railVertical  = 8
+	railCharWidth = 8
+	railBox       = 11 // half the height of a box
+	railFrame     = 8
+	railNote      = 14
+)
+
+type diagram struct {
+	node  *exportNode
+	items []*diagram
+	width int
+	up    int
+	down  int
+	// how far below the line each alternative of a choice is, how far above
+	// it an optional item is skipped and how far below it a repeat loops back
+	offsets []int
+}
+
+func textWidth(text string) int {
+	return utf8.RuneCountInString(text) * railCharWidth
+}
+
+func lookaheadLabel(op string) string {
+	if op == "!" {
+		return "not followed by"
+	}
+	return "followed by"
+}
+
+func layout(node *exportNode) *diagram {
+	d := &diagram{node: node}
+	for _, item := range node.items {
+		d.items = append(d.items, layout(item))
+	}
+	switch node.kind {
+	case exportTerminal, exportReference:
+		d.width = textWidth(node.text) + 2*railArc
+		d.up, d.down = railBox, railBox
+	case exportSequence:
+		for i, item := range d.items {
+			if i > 0 {
+				d.width += railGap
+			}
+			d.width += item.width
+			d.up = max(d.up, item.up)
+			d.down = max(d.down, item.down)
+		}
+	case exportChoice:
+		inner := 0
+		offset := 0
+		for i, item := range d.items {
+			inner = max(inner, item.width)
+			if i > 0 {
+				offset += d.items[i-1].down + railVertical + item.up
+				if i == 1 {
+					offset = max(offset, 2*railArc)
+				}
+			}
+			d.offsets = append(d.offsets, offset)
+		}
+		last := d.items[len(d.items)-1]
+		d.width = inner + 4*railArc
+		d.up, d.down = d.items[0].up, offset+last.down
+	case exportOptional:
+		item := d.items[0]
+		skip := max(2*railArc, item.up+railVertical)
+		d.offsets = []int{skip}
+		d.width = item.width + 4*railArc
+		d.up, d.down = skip, item.down
+	case exportRepeat:
+		item := d.items[0]
+		inner, sepUp, sepDown := item.width, 0, 0
+		if len(d.items) > 1 {
+			sep := d.items[1]
+			inner, sepUp, sepDown = max(inner, sep.width), sep.up, sep.down
+		}
+		loop := max(2*railArc, item.down+railVertical+sepUp)
+		d.offsets = []int{loop}
+		d.width = inner + 4*railArc
+		d.up, d.down = item.up, loop+sepDown
+		if node.text != "" {
+			d.width = max(d.width, textWidth(node.text))
+			d.down += railNote
+		}
+	case exportLookahead:
+		item := d.items[0]
+		d.width = max(item.width+2*railFrame, textWidth(lookaheadLabel(node.text))+railFrame)
+		d.up, d.down = item.up+railFrame+railNote, item.down+railFrame
+	}
+	return d
+}
+
+func railLine(out *strings.Builder, x, y, length int) {
+	if length > 0 {
+		fmt.Fprintf(out, "<path d=\"M%d %d h%d\"/>\n", x, y, length)
+	}
+}
+
+// render draws d with its line entering at x, y
+func (d *diagram) render(out *strings.Builder, x, y int) {
+	a := railArc
+	switch d.node.kind {
+	case exportTerminal:
+		fmt.Fprintf(out, "<rect class=\"terminal\" x=\"%d\" y=\"%d\" width=\"%d\" height=\"%d\" rx=\"%d\"/>\n", x, y-railBox, d.width, 2*railBox, railBox)
+		fmt.Fprintf(out, "<text x=\"%d\" y=\"%d\">%s</text>\n", x+d.width/2, y+4, html.EscapeString(d.node.text))
+	case exportReference:
+		fmt.Fprintf(out, "<a href=\"#%s\">\n", html.EscapeString(d.node.text))
+		fmt.Fprintf(out, "<rect class=\"reference\" x=\"%d\" y=\"%d\" width=\"%d\" height=\"%d\"/>\n", x, y-railBox, d.width, 2*railBox)
+		fmt.Fprintf(out, "<text x=\"%d\" y=\"%d\">%s</text>\n", x+d.width/2, y+4, html.EscapeString(d.node.text))
+		out.WriteString("</a>\n")
+	case exportSequence:
+		for i, item := range d.items {
+			if i > 0 {
+				railLine(out, x, y, railGap)
+				x += railGap
+			}
+			item.render(out, x, y)
+			x += item.width
+		}
+	case exportChoice:
+		inner := d.width - 4*a
+		for i, item := range d.items {
+			offset := d.offsets[i]
+			if i == 0 {
+				railLine(out, x, y, 2*a)
+				railLine(out, x+d.width-2*a, y, 2*a)
+			} else {
+				fmt.Fprintf(out, "<path d=\"M%d %d a%d %d 0 0 1 %d %d v%d a%d %d 0 0 0 %d %d\"/>\n", x, y, a, a, a, a, offset-2*a, a, a, a, a)
+				fmt.Fprintf(out, "<path d=\"M%d %d a%d %d 0 0 0 %d %d v%d a%d %d 0 0 1 %d %d\"/>\n", x+d.width-2*a, y+offset, a, a, a, -a, -(offset - 2*a), a, a, a, -a)
+			}
+			item.render(out, x+2*a, y+offset)
+			railLine(out, x+2*a+item.width, y+offset, inner-item.width)
+		}
+	case exportOptional:
+		item := d.items[0]
+		skip := d.offsets[0]
+		fmt.Fprintf(out, "<path d=\"M%d %d a%d %d 0 0 0 %d %d v%d a%d %d 0 0 1 %d %d h%d a%d %d 0 0 1 %d %d v%d a%d %d 0 0 0 %d %d\"/>\n",
+			x, y, a, a, a, -a, -(skip - 2*a), a, a, a, -a, item.width, a, a, a, a, skip-2*a, a, a, a, a)
+		railLine(out, x, y, 2*a)
+		item.render(out, x+2*a, y)
+		railLine(out, x+2*a+item.width, y, 2*a)
+	case exportRepeat:
+		item := d.items[0]
+		loop := d.offsets[0]
+		inner := d.width - 4*a
+		fmt.Fprintf(out, "<path d=\"M%d %d a%d %d 0 0 1 %d %d v%d a%d %d 0 0 1 %d %d h%d a%d %d 0 0 1 %d %d v%d a%d %d 0 0 1 %d %d\"/>\n",
+			x+2*a+inner, y, a, a, a, a, loop-2*a, a, a, -a, a, -inner, a, a, -a, -a, -(loop - 2*a), a, a, a, -a)
+		railLine(out, x, y, 2*a)
+		item.render(out, x+2*a, y)
+		railLine(out, x+2*a+item.width, y, d.width-item.width-2*a)
+		if len(d.items) > 1 {
+			sep := d.items[1]
+			sep.render(out, x+2*a+(inner-sep.width)/2, y+loop)
+		}
+		if d.node.text != "" {
+			fmt.Fprintf(out, "<text class=\"note\" x=\"%d\" y=\"%d\">%s</text>\n", x+d.width/2, y+d.down-3, html.EscapeString(d.node.text))
+		}
+	case exportLookahead:
+		item := d.items[0]
+		top := y - item.up - railFrame
+		fmt.Fprintf(out, "<rect class=\"lookahead\" x=\"%d\" y=\"%d\" width=\"%d\" height=\"%d\"/>\n", x, top, d.width, item.up+item.down+2*railFrame)
+		fmt.Fprintf(out, "<text class=\"note\" x=\"%d\" y=\"%d\">%s</text>\n", x+d.width/2, top-4, lookaheadLabel(d.node.text))
+		railLine(out, x, y, railFrame)
+		item.render(out, x+railFrame, y)
+		railLine(out, x+railFrame+item.width, y, d.width-item.width-railFrame)
+	}
+}
+
+// railroadSVG draws node with the start of the rule on the left and the end
+// on the right
+func railroadSVG(node *exportNode) string {
+	d := layout(node)
+	margin := 2 * railArc
+	width, height := d.width+2*margin, d.up+d.down+2*railArc
+	y := railArc + d.up
+	var out strings.Builder
+	fmt.Fprintf(&out, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" viewBox=\"0 0 %d %d\">\n", width, height, width, height)
+	fmt.Fprintf(&out, "<path d=\"M%d %d v16 M%d %d h%d\"/>\n", railArc, y-8, railArc, y, margin-railArc)
+	d.render(&out, margin, y)
+	fmt.Fprintf(&out, "<path d=\"M%d %d h%d v-8 v16\"/>\n", margin+d.width, y, margin-railArc)
+	out.WriteString("</svg>\n")
+	return out.String()
+}
+
+const railroadStyle = `body { font-family: sans-serif; }
+svg path { fill: none; stroke: #333; stroke-width: 1.5; }
+svg rect { fill: #fff; stroke: #333; stroke-width: 1.5; }
+svg rect.terminal { fill: #efe; }
+svg rect.reference { fill: #eef; }
+svg rect.lookahead { fill: none; stroke-dasharray: 4 3; }
+svg text { font: 13px monospace; text-anchor: middle; }
+svg text.note { font: 10px sans-serif; }
+svg a:hover rect { fill: #ccf; }
+pre { color: #555; }
+`
+
+// WriteRailroad writes an HTML page with a railroad diagram for every named
+// rule of the grammar made up of rules, along with its production in EBNF
+// (see WriteEBNF). Boxes referring to other rules link to their diagram. The
+// page doesn't load anything, so it can be passed around as it is.
+func WriteRailroad(w io.Writer, rules ...Parser) error {
+	productions := exportProductions(rules)
+	title := "Grammar"
+	if len(productions) > 0 {
+		title = productions[0].name
+	}
+	var out strings.Builder
+	out.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\"/>\n")
+	fmt.Fprintf(&out, "<title>%s</title>\n<style>\n%s</style>\n</head>\n<body>\n", html.EscapeString(title), railroadStyle)
+	for _, p := range productions {
+		name := html.EscapeString(p.name)
+		fmt.Fprintf(&out, "<section id=\"%s\">\n<h2>%s</h2>\n", name, name)
+		out.WriteString(railroadSVG(p.node))
+		fmt.Fprintf(&out, "<pre>%s</pre>\n</section>\n", html.EscapeString(ebnfProduction(p, len(p.name))))
+	}
+	out.WriteString("</body>\n</html>\n")
+	_, err := io.WriteString(w, out.String())
+	return err
+}
@@ -0,0 +1,72 @@
+package gopar
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestWriteRailroad(t *testing.T) {
+	rules := compile(t, pegJson)
+	var out bytes.Buffer
+	if err := WriteRailroad(&out, rules["Value"]); err != nil {
+		t.Fatal(err)
+	}
+
+	// the page has to be well formed for the SVG in it to show
+	ids := map[string]bool{}
+	var links []string
+	decoder := xml.NewDecoder(strings.NewReader(out.String()))
+	decoder.Strict = true
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("%v in\n%s", err, out.String())
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			for _, attr := range start.Attr {
+				switch {
+				case start.Name.Local == "section" && attr.Name.Local == "id":
+					ids[attr.Value] = true
+				case start.Name.Local == "a" && attr.Name.Local == "href":
+					links = append(links, attr.Value)
+				}
+			}
+		}
+	}
+	if len(ids) != 7 {
+		t.Errorf("expected a diagram for every rule, got %v", ids)
+	}
+	for _, link := range links {
+		if !ids[strings.TrimPrefix(link, "#")] {
+			t.Errorf("link to %s goes nowhere", link)
+		}
+	}
+	if !strings.Contains(out.String(), "<pre>Object ::= &#39;{&#39; (KeyValue (&#39;,&#39; KeyValue)*)? &#39;}&#39;</pre>") {
+		t.Errorf("expected the production of Object in\n%s", out.String())
+	}
+}
+
+func TestRailroadLayout(t *testing.T) {
+	letter := &exportNode{kind: exportTerminal, text: "[a-z]"}
+	comma := &exportNode{kind: exportTerminal, text: "','"}
+	list := layout(optionalNode(&exportNode{kind: exportRepeat, items: []*exportNode{letter, comma}}))
+	// box, arcs either side of the loop, arcs either side of the skip
+	if list.width != 5*railCharWidth+2*railArc+8*railArc {
+		t.Errorf("unexpected width %d", list.width)
+	}
+	// the skip goes over the box, the loop goes under it with the comma on it
+	if list.up != 2*railArc || list.down != railBox+railVertical+2*railBox {
+		t.Errorf("unexpected height %d+%d", list.up, list.down)
+	}
+
+	choice := layout(choiceNode([]*exportNode{letter, comma, letter}))
+	if choice.offsets[1] != 2*railBox+railVertical || choice.offsets[2] != 2*(2*railBox+railVertical) {
+		t.Errorf("unexpected offsets %v", choice.offsets)
+	}
+}
@@ -0,0 +1,70 @@
+package gopar
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestRegexp(t *testing.T) {
+	number := R(`-?[0-9]+(\.[0-9]+)?`)
+	expectNoErr(t, number, "12")
+	expectNoErr(t, number, "-1.5")
+	expectNoErr(t, Seq(number, S(".")), "1.")
+	expectErr(t, number, "x1", "error at offset 0 in rule /-?[0-9]+(\\.[0-9]+)?/. expected /-?[0-9]+(\\.[0-9]+)?/ found 'x'")
+	expectErr(t, number, "", "error at offset 0 in rule /-?[0-9]+(\\.[0-9]+)?/. expected /-?[0-9]+(\\.[0-9]+)?/ found EOF")
+
+	// anchored at the current position rather than searching ahead
+	expectErr(t, Seq(S("a"), R(`b`)), "acb", "error at offset 1 in rule _Sequence>/b/. expected /b/ found 'c'")
+	// alternation inside the pattern stays inside the anchor
+	expectErr(t, R(`a|b`), "cb", "error at offset 0 in rule /a|b/. expected /a|b/ found 'c'")
+
+	ident := R(`\pL[\pL\pN_]*`)
+	list := Skip(R(`\s*`), Seq(S("("), DelimitedSeq(Token(Collect(ident)), S(",")), S(")")))
+	expectValues(t, list, "( größe ,変数 , x_1 )", "größe", "変数", "x_1")
+}
+
+// countingReader counts how much was read from it
+type countingReader struct {
+	io.Reader
+	n int
+}
+
+func (r *countingReader) Read(b []byte) (int, error) {
+	n, err := r.Reader.Read(b)
+	r.n += n
+	return n, err
+}
+
+func TestRegexpReadsOnlyWhatItNeeds(t *testing.T) {
+	reader := &countingReader{Reader: strings.NewReader("12345 " + strings.Repeat("x", 10000))}
+	input := NewReader(reader)
+	if err := R(`[0-9]+`).Parse(input); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if input.Offset() != 5 {
+		t.Errorf("unexpected offset: %d", input.Offset())
+	}
+	// the regexp looks a character or two ahead
+	if reader.n > 8 {
+		t.Errorf("read %d bytes", reader.n)
+	}
+}
+
+func BenchmarkNumberAsRegexp(b *testing.B) {
+	benchmarkNumber(b, R(`[0-9]+`))
+}
+
+func BenchmarkNumberAsCharClass(b *testing.B) {
+	benchmarkNumber(b, OneOrMoreOf(OneOfChars("0123456789")))
+}
+
+func benchmarkNumber(b *testing.B, number Parser) {
+	rule := DelimitedSeq(number, S(","))
+	inText := strings.Repeat("1234567890,", 100)
+	for i := 0; i < b.N; i++ {
+		if err := rule.Parse(NewReader(strings.NewReader(inText))); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
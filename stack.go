@@ -0,0 +1,66 @@
+package gopar
+
+// Stack holds the values (abstract syntax tree nodes) built up during a
+// parse. Every ThreadSafeBufferedReader carries its own view of the stack: a
+// Clone starts out with its parent's values, and anything it pushes is thrown
+// away together with the clone when the clone is discarded.
+type Stack struct {
+	values []interface{}
+	// the lowest the stack has been popped to, see memo.go
+	low int
+	// how many values at the bottom other readers can see too
+	shared int
+}
+
+func (s *Stack) Push(value interface{}) {
+	s.own()
+	s.values = append(s.values, value)
+}
+
+// own copies the values before a push would write over one another reader
+// can see, which happens once values were popped below what was shared
+func (s *Stack) own() {
+	if len(s.values) < s.shared {
+		s.values = append([]interface{}{}, s.values...)
+		s.shared = 0
+	}
+}
+
+func (s *Stack) Pop() interface{} {
+	if len(s.values) == 0 {
+		panic("Pop called on empty Stack")
+	}
+	value := s.values[len(s.values)-1]
+	// don't clear the slot, a parent reader may still be looking at it
+	s.values = s.values[:len(s.values)-1]
+	if len(s.values) < s.low {
+		s.low = len(s.values)
+	}
+	return value
+}
+
+func (s *Stack) Peek() interface{} {
+	if len(s.values) == 0 {
+		panic("Peek called on empty Stack")
+	}
+	return s.values[len(s.values)-1]
+}
+
+func (s *Stack) Len() int {
+	return len(s.values)
+}
+
+// Values returns a copy of the stack contents, bottom first.
+func (s *Stack) Values() []interface{} {
+	values := make([]interface{}, len(s.values))
+	copy(values, s.values)
+	return values
+}
+
+// clone caps the capacity of the copied slice so that pushes made by either
+// side reallocate instead of writing into memory the other side can see, and
+// marks the values as shared so that pushes after popping them copy first
+func (s *Stack) clone() Stack {
+	s.shared = len(s.values)
+	return Stack{s.values[:len(s.values):len(s.values)], s.low, len(s.values)}
+}
@@ -0,0 +1,72 @@
+package gopar
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStack(t *testing.T) {
+	s := &Stack{}
+	s.Push(1)
+	s.Push("two")
+	if s.Len() != 2 {
+		t.Errorf("unexpected len: %d", s.Len())
+	}
+	if s.Peek() != "two" {
+		t.Errorf("unexpected peek: %v", s.Peek())
+	}
+	if v := s.Pop(); v != "two" {
+		t.Errorf("unexpected pop: %v", v)
+	}
+	if !reflect.DeepEqual(s.Values(), []interface{}{1}) {
+		t.Errorf("unexpected values: %v", s.Values())
+	}
+}
+
+func TestStackClone(t *testing.T) {
+	parent := Stack{}
+	parent.Push(1)
+	parent.Push(2)
+	parent.Pop()
+
+	// the clone and the parent share a backing array; neither should see the
+	// other's pushes
+	child := parent.clone()
+	child.Push("child")
+	parent.Push("parent")
+	if !reflect.DeepEqual(child.Values(), []interface{}{1, "child"}) {
+		t.Errorf("unexpected child values: %v", child.Values())
+	}
+	if !reflect.DeepEqual(parent.Values(), []interface{}{1, "parent"}) {
+		t.Errorf("unexpected parent values: %v", parent.Values())
+	}
+}
+
+func TestStackClonePopThenPush(t *testing.T) {
+	parent := Stack{}
+	parent.Push(1)
+	parent.Push(2)
+
+	// popping what the parent can see and pushing something else mustn't
+	// change the parent
+	child := parent.clone()
+	child.Pop()
+	child.Push("child")
+	if !reflect.DeepEqual(parent.Values(), []interface{}{1, 2}) {
+		t.Errorf("unexpected parent values: %v", parent.Values())
+	}
+	parent.Pop()
+	parent.Push("parent")
+	if !reflect.DeepEqual(child.Values(), []interface{}{1, "child"}) {
+		t.Errorf("unexpected child values: %v", child.Values())
+	}
+
+	// an alternative that didn't pan out leaves the stack as it was
+	replace := Assemble(S("+"), func(s *Stack) error {
+		s.Pop()
+		s.Push("X")
+		return nil
+	})
+	rule := Seq(Collect(S("1")), OneOf(Seq(replace, S("!")), S("+?")))
+	expectValues(t, rule, "1+?", "1")
+}
@@ -0,0 +1,177 @@
+package gopar
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+/*
+A grammar that rejects input it should accept usually went wrong well before
+the error it reports: an alternative matched that shouldn't have, or one that
+should have got further than expected before it gave up. A Tracer sees every
+rule run along the way. It's told when a rule starts and when it's done, and
+when a rule throws away what a sub rule parsed to try something else, which
+is where OneOf moves on to its next alternative.
+
+Enter and Exit come from parseRule. Rules that run others go through it even
+when their Parse method is called directly, but a single literal, character
+class and the like called that way isn't traced; ParseTraced traces it too. Rules
+replayed by Memoize are traced like any other.
+*/
+
+// Tracer is told what a parse does, see Trace.
+type Tracer interface {
+	// rule is about to be parsed at offset
+	Enter(rule Parser, offset int)
+	// rule matched up to offset, or failed at offset with err
+	Exit(rule Parser, offset int, err error)
+	// rule gave up what it had parsed up to from and went back to to
+	Backtrack(rule Parser, from, to int)
+}
+
+// Trace tells tracer about every parse that starts from this reader; nil
+// turns tracing back off.
+func (tsbr *ThreadSafeBufferedReader) Trace(tracer Tracer) *ThreadSafeBufferedReader {
+	tsbr.state.tracer = tracer
+	return tsbr
+}
+
+// ParseTraced is Parse, with tracer told about everything parser does,
+// parser itself included.
+func ParseTraced(parser Parser, reader io.Reader, tracer Tracer) error {
+	input := NewReader(reader).Trace(tracer)
+	defer input.Done()
+	return input.state.report(parseRule(parser, input), input)
+}
+
+// traceLabel names rule the way ParseError paths do, and the rules that
+// have no name at all after their kind
+func traceLabel(rule Parser) string {
+	if label := ruleLabel(rule); label != "" {
+		return label
+	}
+	kind := kindOf(rule).String()
+	return "_" + strings.ToUpper(kind[:1]) + kind[1:]
+}
+
+// traceMessage is what err says, without the path and offset a trace
+// already shows
+func traceMessage(err error) string {
+	if parseErr, ok := err.(ParseError); ok {
+		return parseErr.Msg
+	}
+	return err.Error()
+}
+
+type textTracer struct {
+	w      io.Writer
+	starts []int
+}
+
+// NewTextTracer returns a Tracer that writes a line to w for everything that
+// happens, indented by how deeply nested the rule it happened in is:
+//
+//	Value at 0
+//	  JsonString at 0
+//	    '"' at 0
+//	    '"' failed at 0: expected '"' found '{'
+//	  JsonString failed at 0: expected '"' found '{'
+//	  Object at 0
+//	    '{' at 0
+//	    '{' matched 0 to 1
+//	    ...
+//	  Object failed at 6: expected '}' found 'x'
+//	  Value backtracked from 6 to 0
+//
+// Errors writing to w are ignored.
+func NewTextTracer(w io.Writer) Tracer {
+	return &textTracer{w: w}
+}
+
+func (t *textTracer) indent() string {
+	return strings.Repeat("  ", len(t.starts))
+}
+
+func (t *textTracer) Enter(rule Parser, offset int) {
+	fmt.Fprintf(t.w, "%s%s at %d\n", t.indent(), traceLabel(rule), offset)
+	t.starts = append(t.starts, offset)
+}
+
+func (t *textTracer) Exit(rule Parser, offset int, err error) {
+	start := t.starts[len(t.starts)-1]
+	t.starts = t.starts[:len(t.starts)-1]
+	if err != nil {
+		fmt.Fprintf(t.w, "%s%s failed at %d: %s\n", t.indent(), traceLabel(rule), offset, traceMessage(err))
+	} else {
+		fmt.Fprintf(t.w, "%s%s matched %d to %d\n", t.indent(), traceLabel(rule), start, offset)
+	}
+}
+
+func (t *textTracer) Backtrack(rule Parser, from, to int) {
+	fmt.Fprintf(t.w, "%s%s backtracked from %d to %d\n", t.indent(), traceLabel(rule), from, to)
+}
+
+// TraceEvent is something a TraceRecorder was told about.
+type TraceEvent struct {
+	// enter, exit or backtrack
+	Event string `json:"event"`
+	Rule  string `json:"rule"`
+	// where the rule started for enter, where it stopped for exit and where
+	// it went back to for backtrack
+	Offset int `json:"offset"`
+	// where a backtracking rule had got to
+	From int `json:"from,omitempty"`
+	// why the rule failed, if it did
+	Error string `json:"error,omitempty"`
+	// how deeply nested the event is, the indentation NewTextTracer would
+	// give it
+	Depth int `json:"depth"`
+}
+
+// TraceRecorder is a Tracer that keeps everything it's told, to be written
+// to a file with WriteJSON.
+type TraceRecorder struct {
+	Events []TraceEvent
+	depth  int
+}
+
+func (r *TraceRecorder) Enter(rule Parser, offset int) {
+	r.Events = append(r.Events, TraceEvent{Event: "enter", Rule: traceLabel(rule), Offset: offset, Depth: r.depth})
+	r.depth++
+}
+
+func (r *TraceRecorder) Exit(rule Parser, offset int, err error) {
+	r.depth--
+	event := TraceEvent{Event: "exit", Rule: traceLabel(rule), Offset: offset, Depth: r.depth}
+	if err != nil {
+		event.Error = traceMessage(err)
+	}
+	r.Events = append(r.Events, event)
+}
+
+func (r *TraceRecorder) Backtrack(rule Parser, from, to int) {
+	r.Events = append(r.Events, TraceEvent{Event: "backtrack", Rule: traceLabel(rule), Offset: to, From: from, Depth: r.depth})
+}
+
+// WriteJSON writes the events recorded so far to w as a JSON object with an
+// "events" array, one event per line.
+func (r *TraceRecorder) WriteJSON(w io.Writer) error {
+	var out strings.Builder
+	out.WriteString("{\"events\": [\n")
+	for i, event := range r.Events {
+		line, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		out.Write(line)
+		if i < len(r.Events)-1 {
+			out.WriteString(",")
+		}
+		out.WriteString("\n")
+	}
+	out.WriteString("]}\n")
+	_, err := io.WriteString(w, out.String())
+	return err
+}
@@ -0,0 +1,179 @@
+package gopar
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestTextTracer(t *testing.T) {
+	word := OneOrMoreOf(CharRange('a', 'z')).Rename("Word")
+	call := Seq(word, S("("), DelimitedSeq(word, S(",")), S(")")).Rename("Call")
+	statement := OneOf(call, Seq(word, S(";"))).Rename("Statement")
+
+	var out bytes.Buffer
+	if err := ParseTraced(statement, strings.NewReader("f(a,);"), NewTextTracer(&out)); err == nil {
+		t.Fatal("expected an error")
+	}
+	expected := `Statement at 0
+  Call at 0
+    Word at 0
+      _AtLeastNumOf at 0
+        [a-z] at 0
+        [a-z] matched 0 to 1
+      _AtLeastNumOf matched 0 to 1
+      _AsManyAsNumOf at 1
+        [a-z] at 1
+        [a-z] failed at 1: expected [a-z] found '('
+      _AsManyAsNumOf matched 1 to 1
+    Word matched 0 to 1
+    '(' at 1
+    '(' matched 1 to 2
+    _DelimitedSeq at 2
+      Word at 2
+        _AtLeastNumOf at 2
+          [a-z] at 2
+          [a-z] matched 2 to 3
+        _AtLeastNumOf matched 2 to 3
+        _AsManyAsNumOf at 3
+          [a-z] at 3
+          [a-z] failed at 3: expected [a-z] found ','
+        _AsManyAsNumOf matched 3 to 3
+      Word matched 2 to 3
+      ',' at 3
+      ',' matched 3 to 4
+      Word at 4
+        _AtLeastNumOf at 4
+          [a-z] at 4
+          [a-z] failed at 4: expected [a-z] found ')'
+        _AtLeastNumOf failed at 4: expected [a-z] found ')'
+      Word failed at 4: expected [a-z] found ')'
+      _DelimitedSeq backtracked from 4 to 3
+    _DelimitedSeq matched 2 to 3
+    ')' at 3
+    ')' failed at 3: expected ')' found ','
+  Call failed at 3: expected ')' found ','
+  Statement backtracked from 3 to 0
+  _Sequence at 0
+    Word at 0
+      _AtLeastNumOf at 0
+        [a-z] at 0
+        [a-z] matched 0 to 1
+      _AtLeastNumOf matched 0 to 1
+      _AsManyAsNumOf at 1
+        [a-z] at 1
+        [a-z] failed at 1: expected [a-z] found '('
+      _AsManyAsNumOf matched 1 to 1
+    Word matched 0 to 1
+    ';' at 1
+    ';' failed at 1: expected ';' found '('
+  _Sequence failed at 1: expected ';' found '('
+  Statement backtracked from 1 to 0
+Statement failed at 3: expected ')' found ','
+`
+	if out.String() != expected {
+		t.Errorf("unexpected trace:\n%s", out.String())
+	}
+}
+
+func TestTraceRecorder(t *testing.T) {
+	ident := Seq(Not(Seq(S("if"), S(" "))), And(CharRange('a', 'z')), OneOrMoreOf(CharRange('a', 'z'))).Rename("Ident")
+	recorder := &TraceRecorder{}
+	if err := ParseTraced(ident, strings.NewReader("iffy"), recorder); err != nil {
+		t.Fatal(err)
+	}
+	var backtracks []TraceEvent
+	for _, event := range recorder.Events {
+		if event.Event == "backtrack" {
+			backtracks = append(backtracks, event)
+		}
+	}
+	// Not and And never keep what they matched
+	if len(backtracks) != 2 || backtracks[0] != (TraceEvent{"backtrack", "_Not", 0, 2, "", 2}) || backtracks[1] != (TraceEvent{"backtrack", "_And", 0, 1, "", 2}) {
+		t.Errorf("unexpected backtracks: %+v", backtracks)
+	}
+	if last := recorder.Events[len(recorder.Events)-1]; last != (TraceEvent{"exit", "Ident", 4, 0, "", 0}) {
+		t.Errorf("unexpected last event: %+v", last)
+	}
+
+	var out bytes.Buffer
+	if err := recorder.WriteJSON(&out); err != nil {
+		t.Fatal(err)
+	}
+	var file struct {
+		Events []TraceEvent
+	}
+	if err := json.Unmarshal(out.Bytes(), &file); err != nil {
+		t.Fatal(err)
+	}
+	if len(file.Events) != len(recorder.Events) || file.Events[1] != recorder.Events[1] {
+		t.Errorf("events didn't survive the trip through JSON:\n%s", out.String())
+	}
+	if !strings.HasPrefix(out.String(), "{\"events\": [\n{\"event\":\"enter\",\"rule\":\"Ident\",\"offset\":0,\"depth\":0},\n") {
+		t.Errorf("unexpected JSON:\n%s", out.String())
+	}
+}
+
+// identityTracer keeps the rules it's told backtracked that it never saw
+// entered
+type identityTracer struct {
+	entered   []Parser
+	strangers []string
+}
+
+func (t *identityTracer) Enter(rule Parser, offset int) {
+	t.entered = append(t.entered, rule)
+}
+
+func (t *identityTracer) Exit(rule Parser, offset int, err error) {}
+
+func (t *identityTracer) Backtrack(rule Parser, from, to int) {
+	for _, entered := range t.entered {
+		if entered == rule {
+			return
+		}
+	}
+	t.strangers = append(t.strangers, traceLabel(rule))
+}
+
+func TestTraceBacktrackNamesEnteredRule(t *testing.T) {
+	ab := Seq(S("a"), S("b"))
+	rule := Skip(ZeroOrMoreOf(S(" ")), Seq(
+		OneOf(ab, S("a")),
+		Not(S("x")),
+		And(ab),
+		ZeroOrMoreOf(ab),
+		DelimitedSeq(S("x"), S(",")),
+	))
+	tracer := &identityTracer{}
+	if err := ParseTraced(rule, strings.NewReader("a ab ab x,x,"), tracer); err != nil {
+		t.Fatal(err)
+	}
+	if len(tracer.strangers) != 0 {
+		t.Errorf("backtracked rules that were never entered: %v", tracer.strangers)
+	}
+}
+
+func TestTraceMemoized(t *testing.T) {
+	// replayed results are traced like any other
+	digits := OneOrMoreOf(CharRange('0', '9')).Rename("Digits")
+	number := OneOf(Seq(digits, S(".")), digits)
+	recorder := &TraceRecorder{}
+	input := NewReader(strings.NewReader("12")).Memoize(100).Trace(recorder)
+	if err := parseRule(number, input); err != nil {
+		t.Fatal(err)
+	}
+	entered := 0
+	for _, event := range recorder.Events {
+		if event.Event == "enter" && event.Rule == "Digits" {
+			entered++
+		}
+	}
+	if entered != 2 {
+		t.Errorf("expected Digits to be entered twice, got %d", entered)
+	}
+	if recorder.depth != 0 {
+		t.Errorf("enter and exit don't match up, depth %d", recorder.depth)
+	}
+}
@@ -0,0 +1,77 @@
+package gopar
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Node is a node of the concrete parse tree built by ParseTree. Start and End
+// are the offsets of the matched bytes in the input.
+type Node struct {
+	Name     string
+	Start    int
+	End      int
+	Matched  []byte
+	Children []*Node
+}
+
+// String renders the tree as Name("matched") for leaves and
+// Name(child child ...) for everything else.
+func (n *Node) String() string {
+	if len(n.Children) == 0 {
+		return fmt.Sprintf("%s(%q)", n.Name, n.Matched)
+	}
+	children := make([]string, len(n.Children))
+	for i, child := range n.Children {
+		children[i] = child.String()
+	}
+	return fmt.Sprintf("%s(%s)", n.Name, strings.Join(children, " "))
+}
+
+// ParseTree parses reader with parser and returns the tree of named rules
+// that matched. Rules without a name, or with a name starting with '_' such as
+// the combinators from api.go, are flattened away; their children are
+// attached to the closest named ancestor. The root node is always there and
+// is named after parser.
+func ParseTree(parser Parser, reader io.Reader) (*Node, error) {
+	input := NewReader(reader)
+	defer input.Done()
+	input.state.buildTree = true
+	err := parseRule(parser, input)
+	if err != nil {
+		return nil, input.state.report(err, input)
+	}
+	return input.nodes[0], nil
+}
+
+// parseNode runs rule and replaces the nodes its sub rules left on input with
+// a single node holding them as children. If rule fails, whoever backtracks
+// throws away input along with the nodes.
+func parseNode(rule Parser, input *ThreadSafeBufferedReader) error {
+	// nodes start where their first token does, like Collect
+	if err := skip(input); err != nil {
+		return err
+	}
+	start := input.Clone()
+	defer start.Done()
+	startOffset := start.Offset()
+	mark := len(input.nodes)
+	err := rule.Parse(input)
+	if err != nil {
+		return err
+	}
+	matched := make([]byte, input.Offset()-startOffset)
+	if _, err := io.ReadFull(start, matched); err != nil {
+		return err
+	}
+	node := &Node{
+		Name:     rule.GetName(),
+		Start:    startOffset,
+		End:      input.Offset(),
+		Matched:  matched,
+		Children: append([]*Node{}, input.nodes[mark:]...),
+	}
+	input.nodes = append(input.nodes[:mark], node)
+	return nil
+}
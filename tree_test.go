@@ -0,0 +1,64 @@
+package gopar
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseTree(t *testing.T) {
+	num := OneOrMoreOf(OneOfChars("0123456789").Rename("Digit")).Rename("Number")
+	ident := OneOrMoreOf(OneOfChars("abcxyz").Rename("_Letter")).Rename("Ident")
+	atom := OneOf(num, ident, Seq(S("("), P("Sum"), S(")")))
+	sum := Seq(atom, ZeroOrMoreOf(Seq(S("+"), atom))).Rename("Sum")
+	if err := Patch(sum); err != nil {
+		t.Fatal(err)
+	}
+
+	tree, err := ParseTree(sum, strings.NewReader("a+(12+b)"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `Sum(Ident("a") Sum(Number(Digit("1") Digit("2")) Ident("b")))`
+	if tree.String() != expected {
+		t.Errorf("unexpected tree: %s", tree)
+	}
+	inner := tree.Children[1]
+	if inner.Start != 3 || inner.End != 7 || string(inner.Matched) != "12+b" {
+		t.Errorf("unexpected span: %d-%d %q", inner.Start, inner.End, inner.Matched)
+	}
+
+	_, err = ParseTree(sum, strings.NewReader("(a+"))
+	if err == nil || err.Error() != "error at offset 3 (line 1, column 4) in rule Sum>_OneOf>_Sequence>Sum>_ZeroOrMoreOf>_Sequence>_OneOf>Number. expected one of Number, Ident, '(' found EOF" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestParseTreeRootAndBacktracking(t *testing.T) {
+	// the first alternative builds an A node before failing, it must not end
+	// up in the tree
+	a := S("a").Rename("A")
+	rule := OneOf(
+		Seq(a, S("x")),
+		Seq(a, S("b").Rename("B")),
+	)
+	tree, err := ParseTree(rule, strings.NewReader("ab"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree.String() != `_OneOf(A("a") B("b"))` {
+		t.Errorf("unexpected tree: %s", tree)
+	}
+}
+
+func TestParseTreeSkip(t *testing.T) {
+	// nodes start after the skipper, not before it
+	rule := Skip(ZeroOrMoreOf(S(" ")), Seq(S("a").Rename("A"), S("b").Rename("B")))
+	tree, err := ParseTree(rule, strings.NewReader("a  b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := tree.Children[len(tree.Children)-1]
+	if b.Start != 3 || b.End != 4 || string(b.Matched) != "b" {
+		t.Errorf("unexpected span: %d-%d %q", b.Start, b.End, b.Matched)
+	}
+}
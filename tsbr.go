@@ -9,28 +9,41 @@ package gopar
 import (
 	"io"
 	"sync"
+	"unicode/utf8"
 )
 
 type Offsetter interface {
 	Offset() int
 }
 
+// how many times in a row the wrapped reader may return nothing before
+// giving up on it, like bufio
+const maxEmptyReads = 100
+
 type sharedBufferedReader struct {
-	wrappedReader    io.Reader
+	wrappedReader io.Reader
+	// how much is asked of the wrapped reader at a time
+	blockSize        int
 	buffer           []byte
 	bytesRead        int
 	globalOffsets    map[int]int
 	mutex            sync.Mutex
 	nextSubscriberId int
+	lines            lineTracker
+	// what the wrapped reader failed with, returned once to the first read
+	// that runs out of buffer and then forgotten, like bufio does
+	err error
 }
 
-func newSharedBufferedReader(reader io.Reader) *sharedBufferedReader {
+func newSharedBufferedReader(reader io.Reader, blockSize int) *sharedBufferedReader {
 	return &sharedBufferedReader{
 		wrappedReader:    reader,
+		blockSize:        blockSize,
 		buffer:           []byte{},
 		bytesRead:        0,
 		globalOffsets:    map[int]int{},
 		nextSubscriberId: 1,
+		lines:            newLineTracker(),
 	}
 }
 
@@ -38,34 +51,74 @@ func (sbr *sharedBufferedReader) read(b []byte, tsbrId int) (int, error) {
 	sbr.mutex.Lock()
 	defer sbr.mutex.Unlock()
 
-	// fulfill request
-	var err error
-	n1 := copy(b, sbr.buffer[sbr.globalOffsets[tsbrId]-sbr.bytesRead:])
-	n2 := 0
-	if n1 < len(b) {
-		//still more to read
-		bEnd := b[n1:]
-		n2, err = sbr.wrappedReader.Read(bEnd)
-		sbr.buffer = append(sbr.buffer, bEnd[:n2]...)
-		if err != nil {
-			return n1 + n2, err
+	start := sbr.globalOffsets[tsbrId] - sbr.bytesRead
+	if missing := start + len(b) - len(sbr.buffer); missing > 0 {
+		sbr.fill(missing)
+	}
+	n := copy(b, sbr.buffer[start:])
+	sbr.globalOffsets[tsbrId] += n
+	sbr.shrink()
+	if n < len(b) {
+		err := sbr.err
+		sbr.err = nil
+		return n, err
+	}
+	return n, nil
+}
+
+// fill reads ahead until at least n more bytes are buffered or the wrapped
+// reader fails. It asks for a whole block at a time, or for all of n if
+// that's more.
+func (sbr *sharedBufferedReader) fill(n int) {
+	want := len(sbr.buffer) + n
+	for empty := 0; len(sbr.buffer) < want && sbr.err == nil; {
+		size := max(sbr.blockSize, want-len(sbr.buffer))
+		if cap(sbr.buffer)-len(sbr.buffer) < size {
+			grown := make([]byte, len(sbr.buffer), 2*len(sbr.buffer)+size)
+			copy(grown, sbr.buffer)
+			sbr.buffer = grown
+		}
+		block := sbr.buffer[len(sbr.buffer) : len(sbr.buffer)+size]
+		m, err := sbr.wrappedReader.Read(block)
+		sbr.lines.track(block[:m])
+		sbr.buffer = sbr.buffer[:len(sbr.buffer)+m]
+		sbr.err = err
+		if m == 0 && err == nil {
+			if empty++; empty == maxEmptyReads {
+				sbr.err = io.ErrNoProgress
+			}
 		}
 	}
-	n := n1 + n2
+}
+
+// advance moves a reader n bytes ahead over input some other reader already
+// fetched.
+func (sbr *sharedBufferedReader) advance(tsbrId, n int) {
+	sbr.mutex.Lock()
+	defer sbr.mutex.Unlock()
 	sbr.globalOffsets[tsbrId] += n
+	sbr.shrink()
+}
+
+// shrink buffer, but hold on to a little of what every reader is done with so
+// error messages can quote it
+func (sbr *sharedBufferedReader) shrink() {
+	keepFrom := sbr.lowestOffset() - retainedContext
+	if keepFrom > sbr.bytesRead {
+		sbr.lines.drop(sbr.buffer[:keepFrom-sbr.bytesRead], keepFrom)
+		sbr.buffer = sbr.buffer[keepFrom-sbr.bytesRead:]
+		sbr.bytesRead = keepFrom
+	}
+}
 
-	// shrink buffer
+func (sbr *sharedBufferedReader) lowestOffset() int {
 	lowestGlobalOffset := MaxInt
 	for _, globalOffset := range sbr.globalOffsets {
 		if globalOffset < lowestGlobalOffset {
 			lowestGlobalOffset = globalOffset
 		}
 	}
-
-	sbr.buffer = sbr.buffer[lowestGlobalOffset-sbr.bytesRead:]
-	sbr.bytesRead = lowestGlobalOffset
-
-	return n, nil
+	return lowestGlobalOffset
 }
 
 /*
@@ -89,23 +142,79 @@ func (sbr *sharedBufferedReader) offset(tsbrId int) int {
 	return sbr.globalOffsets[tsbrId]
 }
 
+// lowestLiveOffset is the offset of the reader furthest behind. No reader
+// will ever go back before it.
+func (sbr *sharedBufferedReader) lowestLiveOffset() int {
+	sbr.mutex.Lock()
+	defer sbr.mutex.Unlock()
+	return sbr.lowestOffset()
+}
+
 func (sbr *sharedBufferedReader) done(tsbrId int) {
 	delete(sbr.globalOffsets, tsbrId)
 }
 
+// buffered is how far the reader furthest behind is behind the one furthest
+// ahead, which is what has to be held on to for the readers. What was read
+// ahead and the context kept for error messages don't count.
+func (sbr *sharedBufferedReader) buffered() int {
+	sbr.mutex.Lock()
+	defer sbr.mutex.Unlock()
+	lowest, highest := MaxInt, 0
+	for _, globalOffset := range sbr.globalOffsets {
+		lowest = min(lowest, globalOffset)
+		highest = max(highest, globalOffset)
+	}
+	if lowest > highest {
+		return 0
+	}
+	return highest - lowest
+}
+
+// release lets go of every reader and everything buffered, for when a parse
+// is given up on and its readers may never be Done
+func (sbr *sharedBufferedReader) release() {
+	sbr.mutex.Lock()
+	defer sbr.mutex.Unlock()
+	sbr.globalOffsets = map[int]int{}
+	sbr.bytesRead += len(sbr.buffer)
+	sbr.buffer = nil
+}
+
 type ThreadSafeBufferedReader struct {
-	sbr *sharedBufferedReader
-	id  int
+	sbr     *sharedBufferedReader
+	id      int
+	state   *parseState
+	stack   Stack
+	nodes   []*Node
+	skipper Parser
 }
 
 func NewReader(reader io.Reader) *ThreadSafeBufferedReader {
-	tsbr := &ThreadSafeBufferedReader{newSharedBufferedReader(reader), 0}
+	return NewReaderSize(reader, 1)
+}
+
+// NewReaderSize is NewReader, reading ahead blockSize bytes at a time. Every
+// reader cloned from it shares what was read ahead, so a rule trying its
+// alternatives only calls Read on reader once. A blockSize of 1 or less
+// only reads what's asked for, like NewReader.
+func NewReaderSize(reader io.Reader, blockSize int) *ThreadSafeBufferedReader {
+	tsbr := &ThreadSafeBufferedReader{
+		sbr:   newSharedBufferedReader(reader, max(blockSize, 1)),
+		state: newParseState(),
+	}
 	tsbr.id = tsbr.sbr.subscribe(0)
 	return tsbr
 }
 
 func (tsbr *ThreadSafeBufferedReader) Clone() *ThreadSafeBufferedReader {
-	childTsbr := &ThreadSafeBufferedReader{tsbr.sbr, 0}
+	childTsbr := &ThreadSafeBufferedReader{
+		sbr:     tsbr.sbr,
+		state:   tsbr.state,
+		stack:   tsbr.stack.clone(),
+		nodes:   tsbr.nodes[:len(tsbr.nodes):len(tsbr.nodes)],
+		skipper: tsbr.skipper,
+	}
 	childTsbr.id = tsbr.sbr.subscribe(tsbr.id)
 	return childTsbr
 }
@@ -118,6 +227,73 @@ func (tsbr *ThreadSafeBufferedReader) Offset() int {
 	return tsbr.sbr.offset(tsbr.id)
 }
 
+// ReadRune reads one UTF-8 encoded rune. Invalid encodings come out as
+// utf8.RuneError and consume a single byte. Only the bytes the rune is made
+// of are read from the wrapped reader.
+func (tsbr *ThreadSafeBufferedReader) ReadRune() (rune, int, error) {
+	r, raw, err := tsbr.readRune()
+	return r, len(raw), err
+}
+
+// readRune is ReadRune but returns the bytes the rune was decoded from
+func (tsbr *ThreadSafeBufferedReader) readRune() (rune, []byte, error) {
+	peek := tsbr.Clone()
+	defer peek.Done()
+	b := make([]byte, utf8.UTFMax)
+	n, err := peek.Read(b[:1])
+	if n == 0 {
+		if err == nil {
+			err = io.EOF
+		}
+		return 0, nil, err
+	}
+	for want := runeLength(b[0]); n < want; {
+		m, err := peek.Read(b[n:want])
+		n += m
+		if n < want && err != nil && err != io.EOF {
+			// leave the rune unread so it can be read again once the
+			// reader recovers
+			return 0, nil, err
+		}
+		if m == 0 || err != nil {
+			break
+		}
+	}
+	r, size := utf8.DecodeRune(b[:n])
+	tsbr.sbr.advance(tsbr.id, size)
+	return r, b[:size], nil
+}
+
+// runeLength is how many bytes a rune starting with b takes up if it's valid
+func runeLength(b byte) int {
+	switch {
+	case b&0xE0 == 0xC0:
+		return 2
+	case b&0xF0 == 0xE0:
+		return 3
+	case b&0xF8 == 0xF0:
+		return 4
+	}
+	return 1
+}
+
+// Stack returns the values pushed onto this reader so far by Collect and
+// Assemble rules.
+func (tsbr *ThreadSafeBufferedReader) Stack() *Stack {
+	return &tsbr.stack
+}
+
+// Memoize turns on packrat parsing for every parse that starts from this
+// reader, see memo.go. At most maxEntries results are remembered at a time;
+// 0 turns it back off.
+func (tsbr *ThreadSafeBufferedReader) Memoize(maxEntries int) *ThreadSafeBufferedReader {
+	tsbr.state.memo = nil
+	if maxEntries > 0 {
+		tsbr.state.memo = newMemo(maxEntries)
+	}
+	return tsbr
+}
+
 func (tsbr *ThreadSafeBufferedReader) Done() {
 	tsbr.sbr.done(tsbr.id)
 }
@@ -3,7 +3,10 @@ package gopar
 import (
 	"bytes"
 	"io"
+	"strings"
 	"testing"
+	"testing/iotest"
+	"time"
 	//	"fmt"
 	"sync"
 )
@@ -153,3 +156,118 @@ func TestImmediateClone(t *testing.T) {
 		t.Error("expected one byte read")
 	}
 }
+
+// slowReader counts the calls to Read and takes its time over every one of
+// them, like a file or a socket would. It spins rather than sleeps, sleeps
+// are rounded up to well over a microsecond.
+type slowReader struct {
+	io.Reader
+	reads int
+	delay time.Duration
+}
+
+func (r *slowReader) Read(b []byte) (int, error) {
+	r.reads++
+	for start := time.Now(); time.Since(start) < r.delay; {
+	}
+	return r.Reader.Read(b)
+}
+
+func TestReaderSize(t *testing.T) {
+	wrapped := &slowReader{Reader: strings.NewReader("0123456789abcdefghij")}
+	reader1 := NewReaderSize(wrapped, 8)
+	reader2 := reader1.Clone()
+	b := make([]byte, 3)
+	if n, err := reader1.Read(b); n != 3 || err != nil || string(b) != "012" {
+		t.Errorf("unexpected read %d %v %q", n, err, b)
+	}
+	if n, err := reader2.Read(b); n != 3 || err != nil || string(b) != "012" {
+		t.Errorf("unexpected read %d %v %q", n, err, b)
+	}
+	if wrapped.reads != 1 {
+		t.Errorf("clones should share the block read ahead, %d reads", wrapped.reads)
+	}
+	// more than a block at once
+	b = make([]byte, 12)
+	if n, err := reader1.Read(b); n != 12 || err != nil || string(b) != "3456789abcde" {
+		t.Errorf("unexpected read %d %v %q", n, err, b)
+	}
+	// the rest, then the end
+	if n, err := reader1.Read(b); n != 5 || err != io.EOF || string(b[:n]) != "fghij" {
+		t.Errorf("unexpected read %d %v %q", n, err, b[:n])
+	}
+	if n, err := reader2.Read(b); n != 12 || err != nil || string(b) != "3456789abcde" {
+		t.Errorf("unexpected read %d %v %q", n, err, b)
+	}
+}
+
+func TestReaderSizeErrors(t *testing.T) {
+	// what was read before the error can still be read, by every reader
+	reader1 := NewReaderSize(iotest.TimeoutReader(strings.NewReader("0123456789")), 4)
+	reader2 := reader1.Clone()
+	b := make([]byte, 6)
+	if n, err := reader1.Read(b[:3]); n != 3 || err != nil {
+		t.Errorf("unexpected read %d %v", n, err)
+	}
+	if n, err := reader1.Read(b); n != 1 || err != iotest.ErrTimeout || b[0] != '3' {
+		t.Errorf("unexpected read %d %v %q", n, err, b[:n])
+	}
+	if n, err := reader2.Read(b[:4]); n != 4 || err != nil || string(b[:4]) != "0123" {
+		t.Errorf("unexpected read %d %v %q", n, err, b[:4])
+	}
+	// the error is only returned once, the next read tries again
+	if n, err := reader1.Read(b[:3]); n != 3 || err != nil || string(b[:3]) != "456" {
+		t.Errorf("unexpected read %d %v %q", n, err, b[:3])
+	}
+
+	// short reads are made up for
+	reader := NewReaderSize(iotest.OneByteReader(strings.NewReader("0123456789")), 4)
+	if n, err := reader.Read(b); n != 6 || err != nil || string(b) != "012345" {
+		t.Errorf("unexpected read %d %v %q", n, err, b)
+	}
+}
+
+func TestReadRuneErrors(t *testing.T) {
+	// the reader fails between the two bytes of the ü
+	reader := NewReader(iotest.OneByteReader(iotest.TimeoutReader(strings.NewReader("üx"))))
+	if r, _, err := reader.readRune(); err != iotest.ErrTimeout || reader.Offset() != 0 {
+		t.Errorf("unexpected rune %q at %d, %v", r, reader.Offset(), err)
+	}
+	for _, expected := range "üx" {
+		if r, _, err := reader.readRune(); r != expected || err != nil {
+			t.Errorf("unexpected rune %q, %v", r, err)
+		}
+	}
+	if _, _, err := reader.readRune(); err != io.EOF {
+		t.Error("expected EOF, got", err)
+	}
+}
+
+func benchmarkSlowReader(b *testing.B, blockSize int) {
+	object := jsonGrammar().object
+	// several blocks long, so there's more than one block to read
+	doc := jsonDocument(200)
+	b.SetBytes(int64(len(doc)))
+	reads := 0
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		wrapped := &slowReader{Reader: strings.NewReader(doc), delay: time.Microsecond}
+		if err := object.Parse(NewReaderSize(wrapped, blockSize)); err != nil {
+			b.Fatal(err)
+		}
+		reads += wrapped.reads
+	}
+	b.ReportMetric(float64(reads)/float64(b.N), "reads/op")
+}
+
+func BenchmarkSlowReaderUnbuffered(b *testing.B) {
+	benchmarkSlowReader(b, 1)
+}
+
+func BenchmarkSlowReader4K(b *testing.B) {
+	benchmarkSlowReader(b, 4<<10)
+}
+
+func BenchmarkSlowReader64K(b *testing.B) {
+	benchmarkSlowReader(b, 64<<10)
+}
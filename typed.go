@@ -0,0 +1,196 @@
+package gopar
+
+import (
+	"fmt"
+)
+
+// Rule is a Parser that leaves exactly one value of type T on the Stack when
+// it matches. Rules can be handed to S, Seq, OneOf and friends like any other
+// Parser, and any Parser can be turned into a Rule with As.
+type Rule[T any] struct {
+	Parser
+}
+
+// untyped lets Patch (and anything else walking a grammar) see through the
+// Rule to the rule it wraps
+func (r Rule[T]) untyped() Parser {
+	return r.Parser
+}
+
+type typedRule interface {
+	untyped() Parser
+}
+
+// unwrapRule strips any Rule[T] wrappers from parser.
+func unwrapRule(parser Parser) Parser {
+	for {
+		typed, ok := parser.(typedRule)
+		if !ok {
+			return parser
+		}
+		parser = typed.untyped()
+	}
+}
+
+// Named renames the wrapped rule and keeps the result typed.
+func (r Rule[T]) Named(name string) Rule[T] {
+	r.Parser.Rename(name)
+	return r
+}
+
+// ParseValue parses input and pops the resulting value.
+func (r Rule[T]) ParseValue(input *ThreadSafeBufferedReader) (T, error) {
+	var zero T
+	if err := parseRule(r, input); err != nil {
+		return zero, err
+	}
+	return pop[T](input.Stack())
+}
+
+func pop[T any](stack *Stack) (T, error) {
+	var zero T
+	if stack.Len() == 0 {
+		return zero, fmt.Errorf("expected a %T on the stack, but it was empty", zero)
+	}
+	value := stack.Pop()
+	if value == nil {
+		return zero, nil
+	}
+	typed, ok := value.(T)
+	if !ok {
+		return zero, fmt.Errorf("expected a %T on the stack, found %T", zero, value)
+	}
+	return typed, nil
+}
+
+// As declares that parser leaves a single T on the stack. This is only
+// checked when the value is popped.
+func As[T any](parser Parser) Rule[T] {
+	return Rule[T]{parser}
+}
+
+// Ref is the typed version of P.
+func Ref[T any](parserName string) Rule[T] {
+	return Rule[T]{P(parserName)}
+}
+
+// Text produces the text matched by parser.
+func Text(parser Parser) Rule[string] {
+	return Rule[string]{Collect(parser)}
+}
+
+// Value produces value whenever parser matches.
+func Value[T any](parser Parser, value T) Rule[T] {
+	return Rule[T]{&assembleRule{
+		parser,
+		func(stack *Stack, mark int) error {
+			stack.Push(value)
+			return nil
+		},
+		"_Value",
+	}}
+}
+
+func Map[A, B any](r Rule[A], f func(A) B) Rule[B] {
+	return Rule[B]{&assembleRule{
+		r,
+		func(stack *Stack, mark int) error {
+			a, err := pop[A](stack)
+			if err != nil {
+				return err
+			}
+			stack.Push(f(a))
+			return nil
+		},
+		"_Map",
+	}}
+}
+
+func Seq2[A, B, R any](a Rule[A], b Rule[B], f func(A, B) R) Rule[R] {
+	return Rule[R]{&assembleRule{
+		Seq(a, b),
+		func(stack *Stack, mark int) error {
+			bv, err := pop[B](stack)
+			if err != nil {
+				return err
+			}
+			av, err := pop[A](stack)
+			if err != nil {
+				return err
+			}
+			stack.Push(f(av, bv))
+			return nil
+		},
+		"_Seq2",
+	}}
+}
+
+func Seq3[A, B, C, R any](a Rule[A], b Rule[B], c Rule[C], f func(A, B, C) R) Rule[R] {
+	return Rule[R]{&assembleRule{
+		Seq(a, b, c),
+		func(stack *Stack, mark int) error {
+			cv, err := pop[C](stack)
+			if err != nil {
+				return err
+			}
+			bv, err := pop[B](stack)
+			if err != nil {
+				return err
+			}
+			av, err := pop[A](stack)
+			if err != nil {
+				return err
+			}
+			stack.Push(f(av, bv, cv))
+			return nil
+		},
+		"_Seq3",
+	}}
+}
+
+// Between matches open, r and close and produces r's value.
+func Between[T any](open Parser, r Rule[T], close Parser) Rule[T] {
+	return Rule[T]{Seq(open, r, close)}
+}
+
+func Choice[T any](rules ...Rule[T]) Rule[T] {
+	parsers := make([]Parser, len(rules))
+	for i, r := range rules {
+		parsers[i] = r
+	}
+	return Rule[T]{OneOf(parsers...)}
+}
+
+// Many matches r zero or more times and produces the values in order.
+func Many[T any](r Rule[T]) Rule[[]T] {
+	return Rule[[]T]{&assembleRule{
+		ZeroOrMoreOf(r),
+		func(stack *Stack, mark int) error {
+			values := make([]T, stack.Len()-mark)
+			for i := len(values) - 1; i >= 0; i-- {
+				value, err := pop[T](stack)
+				if err != nil {
+					return err
+				}
+				values[i] = value
+			}
+			stack.Push(values)
+			return nil
+		},
+		"_Many",
+	}}
+}
+
+// Optional matches r zero or one times and produces def if it didn't match.
+func Optional[T any](r Rule[T], def T) Rule[T] {
+	return Rule[T]{&assembleRule{
+		ZeroOrOneOf(r),
+		func(stack *Stack, mark int) error {
+			if stack.Len() == mark {
+				stack.Push(def)
+			}
+			return nil
+		},
+		"_Optional",
+	}}
+}
@@ -0,0 +1,125 @@
+package gopar
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func expectValue[T any](t *testing.T, rule Rule[T], inText string, expected T) {
+	value, err := rule.ParseValue(NewReader(strings.NewReader(inText)))
+	if err != nil {
+		t.Error("unexpected error:", err)
+	}
+	if !reflect.DeepEqual(value, expected) {
+		t.Errorf("unexpected value: %#v", value)
+	}
+}
+
+func TestMap(t *testing.T) {
+	num := Map(Text(OneOrMoreOf(OneOfChars("0123456789"))), func(s string) int {
+		n, _ := strconv.Atoi(s)
+		return n
+	})
+	expectValue(t, num, "123", 123)
+	expectErr(t, num, "x", "error at offset 0 in rule _Map>_Collect>OneOrMoreOf>>[0-9]. expected [0-9] found 'x'")
+}
+
+func TestSeq2AndSeq3(t *testing.T) {
+	a := Value(S("a"), 1)
+	b := Text(S("b"))
+	pair := Seq2(a, b, func(a int, b string) string { return strconv.Itoa(a) + b })
+	expectValue(t, pair, "ab", "1b")
+	triple := Seq3(a, b, pair, func(a int, b string, p string) []string { return []string{strconv.Itoa(a), b, p} })
+	expectValue(t, triple, "abab", []string{"1", "b", "1b"})
+}
+
+func TestManyAndOptional(t *testing.T) {
+	letters := Many(Text(OneOfChars("abc")))
+	expectValue(t, letters, "", []string{})
+	expectValue(t, letters, "cab", []string{"c", "a", "b"})
+	sign := Optional(Value(S("-"), -1), 1)
+	expectValue(t, sign, "-", -1)
+	expectValue(t, sign, "", 1)
+}
+
+func TestParseValueTypeMismatch(t *testing.T) {
+	_, err := As[int](Text(S("a"))).ParseValue(NewReader(strings.NewReader("a")))
+	if err == nil || err.Error() != "expected a int on the stack, found string" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestTypedJson(t *testing.T) {
+	digits := OneOrMoreOf(OneOfChars("0123456789"))
+	char := OneOfChars(" \t\nabcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789~!@#$%^&*()_+`-={}|[]\\:;'<>?,./'")
+
+	number := Map(Text(Seq(digits, ZeroOrOneOf(Seq(S("."), digits)))), func(s string) interface{} {
+		f, _ := strconv.ParseFloat(s, 64)
+		return f
+	}).Named("Number")
+
+	str := Between(S("\""), Text(OneOrMoreOf(char)), S("\"")).Named("JsonString")
+
+	value := Choice(
+		Map(str, func(s string) interface{} { return s }),
+		number,
+		Ref[interface{}]("Object"),
+		Ref[interface{}]("List"),
+	).Named("Value")
+
+	// comma separated values, with or without a first one
+	values := Optional(Seq2(
+		value,
+		Many(As[interface{}](Seq(S(","), value))),
+		func(first interface{}, rest []interface{}) []interface{} {
+			return append([]interface{}{first}, rest...)
+		},
+	), []interface{}{})
+
+	list := Map(Between(S("["), values, S("]")), func(vs []interface{}) interface{} {
+		return vs
+	}).Named("List")
+
+	type keyValue struct {
+		key   string
+		value interface{}
+	}
+	keyVal := Seq3(str, Value(S(":"), 0), value, func(k string, _ int, v interface{}) keyValue {
+		return keyValue{k, v}
+	}).Named("KeyValue")
+
+	keyVals := Optional(Seq2(
+		keyVal,
+		Many(As[keyValue](Seq(S(","), keyVal))),
+		func(first keyValue, rest []keyValue) []keyValue {
+			return append([]keyValue{first}, rest...)
+		},
+	), nil)
+
+	object := Map(Between(S("{"), keyVals, S("}")), func(kvs []keyValue) interface{} {
+		m := map[string]interface{}{}
+		for _, kv := range kvs {
+			m[kv.key] = kv.value
+		}
+		return m
+	}).Named("Object")
+
+	err := Patch(object, list)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectValue(t, list, `["tree",1.5,[]]`, interface{}([]interface{}{"tree", 1.5, []interface{}{}}))
+	expectValue(t, object, `{"apple":"red","banana":[1,2],"coconut":{"a":1,"b":[],"c":{}}}`, interface{}(map[string]interface{}{
+		"apple":  "red",
+		"banana": []interface{}{1.0, 2.0},
+		"coconut": map[string]interface{}{
+			"a": 1.0,
+			"b": []interface{}{},
+			"c": map[string]interface{}{},
+		},
+	}))
+	expectErr(t, object, `{"apple":"red"`, "error at offset 14 in rule Object>_Sequence>'}'. EOF")
+}
@@ -0,0 +1,506 @@
+package gopar
+
+import (
+	"fmt"
+	"strings"
+)
+
+/*
+Some grammars can't work no matter what they're handed: a repetition of a rule
+that matches the empty string never stops, and an alternative behind one that
+matches whenever it would is never tried. Validate finds these by looking at
+the rules rather than by running them.
+*/
+
+// Severity says how bad a GrammarIssue is.
+type Severity int
+
+const (
+	// the grammar works, but probably not the way it was meant to
+	IssueWarning Severity = iota
+	// the grammar hangs or can't be relied on
+	IssueError
+)
+
+func (s Severity) String() string {
+	if s == IssueError {
+		return "error"
+	}
+	return "warning"
+}
+
+// IssueKind says what Validate found.
+type IssueKind int
+
+const (
+	// a repetition without an upper bound of a rule that matches the empty
+	// string, which loops forever
+	IssueNullableLoop IssueKind = iota
+	// a rule that can get back to itself without consuming anything; Parse
+	// handles that but Generate doesn't
+	IssueLeftRecursion
+	// a named rule the first rule never gets to
+	IssueUnreachable
+	// different rules with the same name, which Patch can't tell apart
+	IssueDuplicateName
+	// an alternative of a OneOf that can never match
+	IssueShadowed
+	// a placeholder Patch hasn't seen
+	IssueUnpatched
+)
+
+// GrammarIssue is a problem with a grammar found by Validate.
+type GrammarIssue struct {
+	Severity Severity
+	Kind     IssueKind
+	// the rules from the one handed to Validate down to the one the issue is
+	// with, named the way ParseError paths are
+	Path []string
+	Msg  string
+}
+
+func (i GrammarIssue) String() string {
+	return fmt.Sprintf("%s in rule %s. %s", i.Severity, strings.Join(i.Path, ">"), i.Msg)
+}
+
+type validator struct {
+	// the first path each rule was found at, in the order they were found
+	paths map[ruleID][]string
+	order []Parser
+	// the rules the first rule gets to
+	reachable map[ruleID]bool
+	nullable  map[ruleID]bool
+	issues    []GrammarIssue
+}
+
+// Validate looks for rules that can't work in the grammar made up of rules.
+// The first rule is where parsing starts; named rules it never gets to are
+// reported as unreachable.
+func Validate(rules ...Parser) []GrammarIssue {
+	v := &validator{paths: map[ruleID][]string{}, reachable: map[ruleID]bool{}}
+	for _, rule := range rules {
+		v.walk(rule, nil)
+	}
+	if len(rules) > 0 {
+		v.markReachable(rules[0])
+	}
+	v.findNullable()
+	v.checkUnpatched()
+	v.checkDuplicateNames()
+	v.checkUnreachable()
+	v.checkLoops()
+	v.checkLeftRecursion()
+	v.checkShadowed()
+	return v.issues
+}
+
+// resolve sees through Rule[T] and patched placeholders to the rule that
+// does the parsing
+func resolve(rule Parser) Parser {
+	rule = unwrapRule(rule)
+	for {
+		placeholder, ok := rule.(*placeholderRule)
+		if !ok || placeholder.patchRule == nil {
+			return rule
+		}
+		rule = unwrapRule(placeholder.patchRule)
+	}
+}
+
+// ruleLabel names rule the way ParseError paths do
+func ruleLabel(rule Parser) string {
+	rule = resolve(rule)
+	switch rule := rule.(type) {
+	case *stringRule:
+		return fmt.Sprintf("'%s'", rule.str)
+	case *foldRule:
+		return fmt.Sprintf("'%s'", rule.str)
+	case *regexpRule:
+		return fmt.Sprintf("/%s/", rule.pattern)
+	case *charClassRule:
+		if isInternalName(rule.name) {
+			return rule.desc
+		}
+	case *keywordsRule:
+		if isInternalName(rule.name) {
+			return rule.desc
+		}
+	}
+	return rule.GetName()
+}
+
+func subRules(rule Parser) []Parser {
+	if _, ok := rule.(*placeholderRule); ok {
+		// unpatched
+		return nil
+	}
+	return rule.GetSubRules()
+}
+
+func (v *validator) walk(rule Parser, path []string) {
+	rule = resolve(rule)
+	if _, ok := v.paths[idOf(rule)]; ok {
+		return
+	}
+	path = append(path[:len(path):len(path)], ruleLabel(rule))
+	v.paths[idOf(rule)] = path
+	v.order = append(v.order, rule)
+	for _, sub := range subRules(rule) {
+		v.walk(sub, path)
+	}
+}
+
+func (v *validator) markReachable(rule Parser) {
+	rule = resolve(rule)
+	if v.reachable[idOf(rule)] {
+		return
+	}
+	v.reachable[idOf(rule)] = true
+	for _, sub := range subRules(rule) {
+		v.markReachable(sub)
+	}
+}
+
+func (v *validator) report(severity Severity, kind IssueKind, rule Parser, format string, args ...interface{}) {
+	v.issues = append(v.issues, GrammarIssue{severity, kind, v.paths[idOf(rule)], fmt.Sprintf(format, args...)})
+}
+
+// findNullable works out which rules can match the empty string. Rules that
+// refer to each other need going over until nothing changes.
+func (v *validator) findNullable() {
+	v.nullable = map[ruleID]bool{}
+	for changed := true; changed; {
+		changed = false
+		for _, rule := range v.order {
+			if !v.nullable[idOf(rule)] && v.canBeEmpty(rule) {
+				v.nullable[idOf(rule)] = true
+				changed = true
+			}
+		}
+	}
+}
+
+func (v *validator) isNullable(rule Parser) bool {
+	return v.nullable[idOf(resolve(rule))]
+}
+
+// canBeEmpty says whether rule can match the empty string as far as is known
+// so far
+func (v *validator) canBeEmpty(rule Parser) bool {
+	switch rule := rule.(type) {
+	case *stringRule:
+		return rule.str == ""
+	case *foldRule:
+		return rule.str == ""
+	case *sequenceRule:
+		for _, sub := range rule.subRules {
+			if !v.isNullable(sub) {
+				return false
+			}
+		}
+		return true
+	case *oneOfRule:
+		for _, sub := range rule.subRules {
+			if v.isNullable(sub) {
+				return true
+			}
+		}
+		return false
+	case *atLeastNumOfRule:
+		return rule.num == 0 || v.isNullable(rule.subRule)
+	case *asManyAsNumOfRule, *notRule, *andRule, *offsetRule:
+		return true
+	case *collectorRule:
+		return v.isNullable(rule.subRule)
+	case *assembleRule:
+		return v.isNullable(rule.subRule)
+	case *tokenRule:
+		return v.isNullable(rule.subRule)
+	case *skipRule:
+		return v.isNullable(rule.subRule)
+	case *expressionRule:
+		return v.isNullable(rule.operand)
+	case *delimitedSeqRule:
+		if rule.min == 0 {
+			return true
+		}
+		sepNullable := v.isNullable(rule.sep)
+		return v.isNullable(rule.elem) && (rule.min == 1 || sepNullable) && (rule.trailing != RequiredTrailing || sepNullable)
+	case *regexpRule:
+		return rule.re.MatchString("")
+	}
+	// char classes, keywords and rules from elsewhere
+	return false
+}
+
+// alwaysMatches says whether rule matches whatever it's handed
+func (v *validator) alwaysMatches(rule Parser, visiting map[ruleID]bool) bool {
+	rule = resolve(rule)
+	id := idOf(rule)
+	if visiting[id] {
+		return false
+	}
+	visiting[id] = true
+	defer delete(visiting, id)
+	switch rule := rule.(type) {
+	case *stringRule:
+		return rule.str == ""
+	case *asManyAsNumOfRule:
+		return true
+	case *sequenceRule:
+		for _, sub := range rule.subRules {
+			if !v.alwaysMatches(sub, visiting) {
+				return false
+			}
+		}
+		return true
+	case *oneOfRule:
+		for _, sub := range rule.subRules {
+			if v.alwaysMatches(sub, visiting) {
+				return true
+			}
+		}
+		return false
+	case *atLeastNumOfRule:
+		return rule.num == 0 || v.alwaysMatches(rule.subRule, visiting)
+	case *collectorRule:
+		return v.alwaysMatches(rule.subRule, visiting)
+	case *tokenRule:
+		return v.alwaysMatches(rule.subRule, visiting)
+	case *skipRule:
+		return v.alwaysMatches(rule.subRule, visiting)
+	case *andRule:
+		return v.alwaysMatches(rule.subRule, visiting)
+	case *delimitedSeqRule:
+		return rule.min == 0 && rule.trailing != RequiredTrailing
+	}
+	return false
+}
+
+// leftCalls returns the rules rule may run without having consumed anything
+func (v *validator) leftCalls(rule Parser) []Parser {
+	switch rule := rule.(type) {
+	case *sequenceRule:
+		var calls []Parser
+		for _, sub := range rule.subRules {
+			calls = append(calls, sub)
+			if !v.isNullable(sub) {
+				break
+			}
+		}
+		return calls
+	case *delimitedSeqRule:
+		if v.isNullable(rule.elem) {
+			return []Parser{rule.elem, rule.sep}
+		}
+		return []Parser{rule.elem}
+	case *expressionRule:
+		calls := []Parser{rule.operand}
+		for _, op := range rule.operators {
+			if op.fixity == prefix {
+				calls = append(calls, op.op)
+			}
+		}
+		return calls
+	case *skipRule:
+		return []Parser{rule.subRule}
+	case *placeholderRule:
+		return nil
+	}
+	return rule.GetSubRules()
+}
+
+func (v *validator) checkUnpatched() {
+	for _, rule := range v.order {
+		if placeholder, ok := rule.(*placeholderRule); ok {
+			v.report(IssueError, IssueUnpatched, rule, "placeholder '%s' isn't patched", placeholder.patchRuleName)
+		}
+	}
+}
+
+// isOneOrMoreOf tells the rules OneOrMoreOf makes, which all have the same
+// name, from rules named by the grammar
+func isOneOrMoreOf(rule Parser) bool {
+	_, ok := repeatedByOneOrMoreOf(rule)
+	return ok && rule.GetName() == "OneOrMoreOf"
+}
+
+// repeatedByOneOrMoreOf returns what rule repeats if OneOrMoreOf made it,
+// whatever it was renamed to since
+func repeatedByOneOrMoreOf(rule Parser) (Parser, bool) {
+	seq, ok := rule.(*sequenceRule)
+	if !ok || len(seq.subRules) != 2 {
+		return nil, false
+	}
+	first, ok := seq.subRules[0].(*atLeastNumOfRule)
+	if !ok || first.num != 1 || first.name != "" {
+		return nil, false
+	}
+	second, ok := seq.subRules[1].(*asManyAsNumOfRule)
+	if !ok || second.num != MaxInt || second.name != "" || second.subRule != first.subRule {
+		return nil, false
+	}
+	return first.subRule, true
+}
+
+func (v *validator) checkDuplicateNames() {
+	referenced := map[string]bool{}
+	for _, rule := range v.order {
+		for _, sub := range subRules(rule) {
+			if placeholder, ok := unwrapRule(sub).(*placeholderRule); ok {
+				referenced[placeholder.patchRuleName] = true
+			}
+		}
+	}
+	byName := map[string]Parser{}
+	for _, rule := range v.order {
+		name := rule.GetName()
+		if _, ok := rule.(*placeholderRule); ok || isInternalName(name) || isOneOrMoreOf(rule) {
+			continue
+		}
+		first, ok := byName[name]
+		if !ok {
+			byName[name] = rule
+			continue
+		}
+		// it's only a matter of which one Patch picks if P refers to it
+		severity := IssueWarning
+		if referenced[name] {
+			severity = IssueError
+		}
+		v.report(severity, IssueDuplicateName, rule, "another rule is named %s too, at %s", name, strings.Join(v.paths[idOf(first)], ">"))
+	}
+}
+
+func (v *validator) checkUnreachable() {
+	if len(v.order) == 0 {
+		return
+	}
+	start := v.order[0]
+	for _, rule := range v.order {
+		if !v.reachable[idOf(rule)] && !isInternalName(rule.GetName()) && !isOneOrMoreOf(rule) {
+			v.report(IssueWarning, IssueUnreachable, rule, "%s is never used by %s", rule.GetName(), ruleLabel(start))
+		}
+	}
+}
+
+func (v *validator) checkLoops() {
+	for _, rule := range v.order {
+		switch rule := rule.(type) {
+		case *asManyAsNumOfRule:
+			if rule.num == MaxInt && v.isNullable(rule.subRule) {
+				v.report(IssueError, IssueNullableLoop, rule, "%s can match the empty string, so repeating it never stops", ruleLabel(rule.subRule))
+			}
+		case *delimitedSeqRule:
+			if rule.max == MaxInt && v.isNullable(rule.elem) && v.isNullable(rule.sep) {
+				v.report(IssueError, IssueNullableLoop, rule, "%s and %s can both match the empty string, so repeating them never stops", ruleLabel(rule.elem), ruleLabel(rule.sep))
+			}
+		}
+	}
+}
+
+func (v *validator) checkLeftRecursion() {
+	reported := map[ruleID]bool{}
+	for _, rule := range v.order {
+		if reported[idOf(rule)] || isInternalName(rule.GetName()) {
+			continue
+		}
+		cycle := v.leftCycle(rule)
+		if cycle == nil {
+			continue
+		}
+		labels := make([]string, len(cycle))
+		for i, r := range cycle {
+			reported[idOf(r)] = true
+			labels[i] = ruleLabel(r)
+		}
+		v.report(IssueWarning, IssueLeftRecursion, rule, "%s is left recursive: %s", rule.GetName(), strings.Join(labels, ">"))
+	}
+}
+
+// leftCycle returns the shortest way from rule back to itself without
+// consuming anything, or nil if there isn't one
+func (v *validator) leftCycle(rule Parser) []Parser {
+	from := map[ruleID]Parser{}
+	queue := []Parser{rule}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, call := range v.leftCalls(current) {
+			call = resolve(call)
+			if idOf(call) == idOf(rule) {
+				cycle := []Parser{rule}
+				for r := current; idOf(r) != idOf(rule); r = from[idOf(r)] {
+					cycle = append([]Parser{r}, cycle...)
+				}
+				return append([]Parser{rule}, cycle...)
+			}
+			if _, seen := from[idOf(call)]; !seen {
+				from[idOf(call)] = current
+				queue = append(queue, call)
+			}
+		}
+	}
+	return nil
+}
+
+func (v *validator) checkShadowed() {
+	for _, rule := range v.order {
+		oneOf, ok := rule.(*oneOfRule)
+		if !ok {
+			continue
+		}
+	alternatives:
+		for j, later := range oneOf.subRules {
+			for i, earlier := range oneOf.subRules[:j] {
+				switch {
+				case idOf(resolve(earlier)) == idOf(resolve(later)):
+					v.report(IssueWarning, IssueShadowed, rule, "alternative %d (%s) is the same as alternative %d", j+1, ruleLabel(later), i+1)
+				case v.alwaysMatches(earlier, map[ruleID]bool{}):
+					v.report(IssueWarning, IssueShadowed, rule, "alternative %d (%s) is never tried, alternative %d (%s) always matches", j+1, ruleLabel(later), i+1, ruleLabel(earlier))
+				case shadows(earlier, later):
+					v.report(IssueWarning, IssueShadowed, rule, "alternative %d (%s) can never match, alternative %d (%s) matches first", j+1, ruleLabel(later), i+1, ruleLabel(earlier))
+				default:
+					continue
+				}
+				continue alternatives
+			}
+		}
+	}
+}
+
+// shadows says whether earlier, a literal, matches wherever later could,
+// like S("a") does for S("abx")
+func shadows(earlier, later Parser) bool {
+	literal, ok := resolve(earlier).(*stringRule)
+	if !ok {
+		return false
+	}
+	return strings.HasPrefix(literalPrefix(later, map[ruleID]bool{}), literal.str)
+}
+
+// literalPrefix is a string everything rule matches starts with
+func literalPrefix(rule Parser, visiting map[ruleID]bool) string {
+	rule = resolve(rule)
+	if visiting[idOf(rule)] {
+		return ""
+	}
+	visiting[idOf(rule)] = true
+	switch rule := rule.(type) {
+	case *stringRule:
+		return rule.str
+	case *sequenceRule:
+		return literalPrefix(rule.subRules[0], visiting)
+	case *collectorRule:
+		return literalPrefix(rule.subRule, visiting)
+	case *assembleRule:
+		return literalPrefix(rule.subRule, visiting)
+	case *tokenRule:
+		return literalPrefix(rule.subRule, visiting)
+	case *atLeastNumOfRule:
+		if rule.num > 0 {
+			return literalPrefix(rule.subRule, visiting)
+		}
+	}
+	return ""
+}
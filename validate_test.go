@@ -0,0 +1,116 @@
+package gopar
+
+import (
+	"testing"
+)
+
+func expectIssues(t *testing.T, issues []GrammarIssue, expected ...string) {
+	t.Helper()
+	if len(issues) != len(expected) {
+		t.Errorf("expected %d issues, got %v", len(expected), issues)
+		return
+	}
+	for i, issue := range issues {
+		if issue.String() != expected[i] {
+			t.Errorf("unexpected issue: %s", issue)
+		}
+	}
+}
+
+func TestValidateJson(t *testing.T) {
+	json := jsonGrammar()
+	expectIssues(t, Validate(json.object, json.list))
+	expectIssues(t, Validate(compile(t, pegJson)["Value"]))
+}
+
+func TestValidateNullableLoops(t *testing.T) {
+	spaces := ZeroOrMoreOf(S(" ")).Rename("Spaces")
+	expectIssues(t, Validate(Seq(ZeroOrMoreOf(spaces), S("x")).Rename("Line")),
+		"error in rule Line>_ZeroOrMoreOf. Spaces can match the empty string, so repeating it never stops")
+
+	// through a placeholder and an optional sequence
+	item := Seq(ZeroOrOneOf(S("-")), ZeroOrMoreOf(P("Item"))).Rename("Item")
+	if err := Patch(item); err != nil {
+		t.Fatal(err)
+	}
+	expectIssues(t, Validate(item),
+		"error in rule Item>_ZeroOrMoreOf. Item can match the empty string, so repeating it never stops",
+		"warning in rule Item. Item is left recursive: Item>_ZeroOrMoreOf>Item")
+
+	expectIssues(t, Validate(DelimitedSeq(ZeroOrOneOf(S("x")), ZeroOrOneOf(S(","))).Rename("List")),
+		"error in rule List. _ZeroOrOneOf and _ZeroOrOneOf can both match the empty string, so repeating them never stops")
+
+	// bounded repetitions and repetitions of things that consume are fine
+	expectIssues(t, Validate(Seq(AsManyAsNumOf(spaces, 3), OneOrMoreOf(S("x")), ZeroOrMoreOf(Not(S("y")))).Rename("Fine")),
+		"error in rule Fine>_ZeroOrMoreOf. _Not can match the empty string, so repeating it never stops")
+}
+
+func TestValidateLeftRecursion(t *testing.T) {
+	num := OneOrMoreOf(OneOfChars("0123456789")).Rename("Num")
+	sum := OneOf(Seq(P("Sum"), S("+"), num), num).Rename("Sum")
+	if err := Patch(sum); err != nil {
+		t.Fatal(err)
+	}
+	expectIssues(t, Validate(sum),
+		"warning in rule Sum. Sum is left recursive: Sum>_Sequence>Sum")
+
+	// indirect, and hidden behind something that can be empty
+	a := OneOf(Seq(ZeroOrOneOf(S("-")), P("B"), S("a")), S("x")).Rename("A")
+	b := OneOf(Seq(P("A"), S("b")), S("y")).Rename("B")
+	if err := Patch(a, b); err != nil {
+		t.Fatal(err)
+	}
+	expectIssues(t, Validate(a),
+		"warning in rule A. A is left recursive: A>_Sequence>B>_Sequence>A")
+
+	// recursion after something was consumed is fine
+	list := Seq(S("("), ZeroOrOneOf(P("List")), S(")")).Rename("List")
+	if err := Patch(list); err != nil {
+		t.Fatal(err)
+	}
+	expectIssues(t, Validate(list))
+}
+
+func TestValidateUnreachableAndDuplicates(t *testing.T) {
+	rules := compile(t, `
+		Start  <- Word (' ' Word)*
+		Word   <- [a-z]+
+		Number <- [0-9]+
+	`)
+	expectIssues(t, Validate(rules["Start"], rules["Word"], rules["Number"]),
+		"warning in rule Number. Number is never used by Start")
+
+	word := OneOrMoreOf(OneOfChars("abc")).Rename("Word")
+	other := S("w").Rename("Word")
+	expectIssues(t, Validate(Seq(word, S(" "), other).Rename("Start")),
+		"warning in rule Start>'w'. another rule is named Word too, at Start>Word")
+
+	// when a placeholder refers to the name it's anybody's guess which one
+	// Patch picked
+	expectIssues(t, Validate(Seq(word, P("Word"), other).Rename("Start")),
+		"error in rule Start>Word. placeholder 'Word' isn't patched",
+		"error in rule Start>'w'. another rule is named Word too, at Start>Word")
+}
+
+func TestValidateShadowed(t *testing.T) {
+	a := S("a")
+	expectIssues(t, Validate(OneOf(a, S("abx"), Seq(S("ab"), S("c")), S("b"), a).Rename("Op")),
+		"warning in rule Op. alternative 2 ('abx') can never match, alternative 1 ('a') matches first",
+		"warning in rule Op. alternative 3 (_Sequence) can never match, alternative 1 ('a') matches first",
+		"warning in rule Op. alternative 5 ('a') is the same as alternative 1")
+	expectIssues(t, Validate(OneOf(ZeroOrMoreOf(S("x")), S("y")).Rename("Xs")),
+		"warning in rule Xs. alternative 2 ('y') is never tried, alternative 1 (_ZeroOrMoreOf) always matches")
+	// longer first is how it's meant to be done
+	expectIssues(t, Validate(OneOf(S("<="), S("<"), Seq(S("<"), S(">"))).Rename("Op")),
+		"warning in rule Op. alternative 3 (_Sequence) can never match, alternative 2 ('<') matches first")
+}
+
+func TestValidateRulesThatCantBeCompared(t *testing.T) {
+	// firstOf isn't a pointer and holds a slice, and refers to itself
+	var rule Parser = firstOf{[]Parser{S("x"), Seq(S("("), P("firstOf"), S(")"))}}
+	if err := Patch(rule); err != nil {
+		t.Fatal(err)
+	}
+	expectIssues(t, Validate(OneOf(rule, rule)),
+		"warning in rule _OneOf. alternative 2 (firstOf) is the same as alternative 1")
+}